@@ -0,0 +1,239 @@
+package dataloaders
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"github.com/jinzhu/gorm"
+)
+
+// Rows buffered per table before they are written in one statement
+const BulkRows = 500
+
+// Most bind parameters PostgreSQL accepts in one statement
+const maxBindParameters = 65535
+
+// Buffers models and writes them in bulk using PostgreSQL
+// INSERT ... ON CONFLICT DO UPDATE, replacing one SELECT and one INSERT or
+// UPDATE per row with a single statement per BulkRows rows.
+type BulkWriter struct {
+	size int
+	tables []*bulkTable
+	byName map[string]*bulkTable
+}
+
+// Buffered rows for one table
+type bulkTable struct {
+	name string
+	table string
+	columns []string
+	conflict []string
+	updates []string
+	skip map[string]bool // generated columns left out of inserts
+	key map[string]bool // columns identifying a row
+	rows [][]interface{}
+	keys map[string]int
+	counts RowCounts // written since the counts were last taken
+}
+
+// Creates a bulk writer that flushes a table once size rows are buffered
+func NewBulkWriter(size int) *BulkWriter {
+	if size < 1 {
+		size = BulkRows
+	}
+	return &BulkWriter{size: size, byName: make(map[string]*bulkTable)}
+}
+
+// Buffers a model, writing its table to db once the buffer is full. A model
+// with the same key as one already buffered replaces it. Rows are identified
+// by the model's unique index if it has one, in which case a generated
+// surrogate primary key is left to the database, otherwise by the primary
+// key.
+func (w *BulkWriter) Write(db *gorm.DB, model interface{}) error {
+	scope := db.NewScope(model)
+	t := w.table(scope)
+	now := time.Now()
+	row := make([]interface{}, 0, len(t.columns))
+	key := ""
+	for _, field := range scope.Fields() {
+		if !field.IsNormal || field.IsIgnored || t.skip[field.DBName] {
+			continue
+		}
+		switch field.DBName {
+		case "created_at", "updated_at":
+			row = append(row, now)
+		default:
+			row = append(row, field.Field.Interface())
+		}
+		if t.key[field.DBName] {
+			key += fmt.Sprint(field.Field.Interface()) + "\x00"
+		}
+	}
+
+	if i, ok := t.keys[key]; ok {
+		t.rows[i] = row
+		t.counts.Skipped += 1
+		return nil
+	}
+	t.keys[key] = len(t.rows)
+	t.rows = append(t.rows, row)
+
+	if len(t.rows) >= w.size {
+		return t.flush(db)
+	}
+	return nil
+}
+
+// Writes all buffered rows to db, in the order their tables were first seen
+func (w *BulkWriter) Flush(db *gorm.DB) error {
+	for _, t := range w.tables {
+		if err := t.flush(db); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Discards all buffered rows and row counts
+func (w *BulkWriter) Reset() {
+	for _, t := range w.tables {
+		t.reset()
+		t.counts = RowCounts{}
+	}
+}
+
+// Returns the rows inserted, updated and skipped in each table since the
+// counts were last taken or reset
+func (w *BulkWriter) TakeCounts() map[string]RowCounts {
+	counts := make(map[string]RowCounts)
+	for _, t := range w.tables {
+		if t.counts != (RowCounts{}) {
+			counts[t.table] = t.counts
+		}
+		t.counts = RowCounts{}
+	}
+	return counts
+}
+
+func (w *BulkWriter) table(scope *gorm.Scope) *bulkTable {
+	name := scope.QuotedTableName()
+	if t, ok := w.byName[name]; ok {
+		return t
+	}
+	t := &bulkTable{name: name, table: scope.TableName(), skip: make(map[string]bool), key: make(map[string]bool)}
+
+	// Identify rows by the first unique index, if any, instead of the primary key
+	unique := ""
+	for _, field := range scope.Fields() {
+		if index := field.TagSettings["UNIQUE_INDEX"]; index != "" && unique == "" {
+			unique = index
+		}
+	}
+	for _, field := range scope.Fields() {
+		if !field.IsNormal || field.IsIgnored {
+			continue
+		}
+		if unique != "" {
+			if field.TagSettings["UNIQUE_INDEX"] == unique {
+				t.key[field.DBName] = true
+			} else if field.IsPrimaryKey {
+				t.skip[field.DBName] = true
+			}
+		} else if field.IsPrimaryKey {
+			t.key[field.DBName] = true
+		}
+	}
+
+	for _, field := range scope.Fields() {
+		if !field.IsNormal || field.IsIgnored || t.skip[field.DBName] {
+			continue
+		}
+		column := scope.Quote(field.DBName)
+		t.columns = append(t.columns, column)
+		if t.key[field.DBName] {
+			t.conflict = append(t.conflict, column)
+		} else if field.DBName != "created_at" {
+			t.updates = append(t.updates, column + " = EXCLUDED." + column)
+		}
+	}
+	t.reset()
+	w.tables = append(w.tables, t)
+	w.byName[name] = t
+	return t
+}
+
+func (t *bulkTable) reset() {
+	t.rows = nil
+	t.keys = make(map[string]int)
+}
+
+func (t *bulkTable) flush(db *gorm.DB) error {
+	perStatement := maxBindParameters / len(t.columns)
+	for start := 0; start < len(t.rows); start += perStatement {
+		end := start + perStatement
+		if end > len(t.rows) {
+			end = len(t.rows)
+		}
+		if err := t.exec(db, t.rows[start:end]); err != nil {
+			return err
+		}
+	}
+	t.reset()
+	return nil
+}
+
+func (t *bulkTable) exec(db *gorm.DB, rows [][]interface{}) error {
+	sql, vars := t.statement(rows)
+	result, err := db.CommonDB().Query(sql, vars...)
+	if err != nil {
+		return err
+	}
+	defer result.Close()
+	written := 0
+	for result.Next() {
+		var inserted bool
+		if err := result.Scan(&inserted); err != nil {
+			return err
+		}
+		if inserted {
+			t.counts.Inserted += 1
+		} else {
+			t.counts.Updated += 1
+		}
+		written += 1
+	}
+	t.counts.Skipped += len(rows) - written
+	return result.Err()
+}
+
+// Builds the statement upserting rows, with its bind parameters
+func (t *bulkTable) statement(rows [][]interface{}) (string, []interface{}) {
+	var sql bytes.Buffer
+	vars := make([]interface{}, 0, len(rows) * len(t.columns))
+	sql.WriteString("INSERT INTO " + t.name + " (" + strings.Join(t.columns, ", ") + ") VALUES ")
+	for i, row := range rows {
+		if i > 0 {
+			sql.WriteString(", ")
+		}
+		sql.WriteString("(")
+		for j := range row {
+			if j > 0 {
+				sql.WriteString(", ")
+			}
+			sql.WriteString("$" + strconv.Itoa(len(vars) + j + 1))
+		}
+		sql.WriteString(")")
+		vars = append(vars, row...)
+	}
+	sql.WriteString(" ON CONFLICT (" + strings.Join(t.conflict, ", ") + ")")
+	if len(t.updates) > 0 {
+		sql.WriteString(" DO UPDATE SET " + strings.Join(t.updates, ", "))
+	} else {
+		sql.WriteString(" DO NOTHING")
+	}
+	// xmax is only zero for a row version this statement inserted
+	sql.WriteString(" RETURNING (xmax = 0)")
+	return sql.String(), vars
+}
@@ -0,0 +1,158 @@
+package dataloaders
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Identified by its primary key
+type bulkKeyed struct {
+	ID string `gorm:"primary_key"`
+	Name string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (bulkKeyed) TableName() string {
+	return "keyed"
+}
+
+// Identified by a unique index, with a generated surrogate key
+type bulkIndexed struct {
+	ID int `gorm:"primary_key"`
+	Code string `gorm:"unique_index:idx_indexed_code_year"`
+	Year string `gorm:"unique_index:idx_indexed_code_year"`
+	Value int
+}
+
+func (bulkIndexed) TableName() string {
+	return "indexed"
+}
+
+// Nothing but its key to update
+type bulkKeyOnly struct {
+	ID string `gorm:"primary_key"`
+}
+
+func (bulkKeyOnly) TableName() string {
+	return "key_only"
+}
+
+func TestBulkWriterStatement(t *testing.T) {
+	db, _ := openFakeDB(t)
+	tests := []struct {
+		name string
+		models []interface{}
+		sql string
+		vars int
+	}{
+		{"primary key", []interface{}{&bulkKeyed{ID: "a"}, &bulkKeyed{ID: "b"}},
+			`INSERT INTO "keyed" ("id", "name", "created_at", "updated_at") VALUES ($1, $2, $3, $4), ($5, $6, $7, $8)` +
+				` ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name", "updated_at" = EXCLUDED."updated_at" RETURNING (xmax = 0)`, 8},
+		{"unique index", []interface{}{&bulkIndexed{Code: "a", Year: "2015-16"}},
+			`INSERT INTO "indexed" ("code", "year", "value") VALUES ($1, $2, $3)` +
+				` ON CONFLICT ("code", "year") DO UPDATE SET "value" = EXCLUDED."value" RETURNING (xmax = 0)`, 3},
+		{"key only", []interface{}{&bulkKeyOnly{ID: "a"}},
+			`INSERT INTO "key_only" ("id") VALUES ($1) ON CONFLICT ("id") DO NOTHING RETURNING (xmax = 0)`, 1},
+	}
+	for _, test := range tests {
+		w := NewBulkWriter(BulkRows)
+		for _, model := range test.models {
+			if err := w.Write(db, model); err != nil {
+				t.Fatal(test.name, err)
+			}
+		}
+		table := w.tables[0]
+		sql, vars := table.statement(table.rows)
+		if sql != test.sql {
+			t.Errorf("%s: statement\n%s\nwant\n%s", test.name, sql, test.sql)
+		}
+		if len(vars) != test.vars {
+			t.Errorf("%s: %d bind parameters, want %d", test.name, len(vars), test.vars)
+		}
+	}
+}
+
+func TestBulkWriterReplacesRowsWithSameKey(t *testing.T) {
+	db, _ := openFakeDB(t)
+	tests := []struct {
+		name string
+		models []interface{}
+		rows int
+		skipped int
+		last interface{} // value of the last column of the last row
+	}{
+		{"primary key", []interface{}{&bulkKeyed{ID: "a", Name: "x"}, &bulkKeyed{ID: "a", Name: "y"}}, 1, 1, nil},
+		{"unique index", []interface{}{&bulkIndexed{ID: 1, Code: "a", Year: "2015-16", Value: 1},
+			&bulkIndexed{ID: 2, Code: "a", Year: "2015-16", Value: 2}}, 1, 1, 2},
+		{"other year", []interface{}{&bulkIndexed{Code: "a", Year: "2014-15", Value: 1},
+			&bulkIndexed{Code: "a", Year: "2015-16", Value: 2}}, 2, 0, 2},
+	}
+	for _, test := range tests {
+		w := NewBulkWriter(BulkRows)
+		for _, model := range test.models {
+			if err := w.Write(db, model); err != nil {
+				t.Fatal(test.name, err)
+			}
+		}
+		table := w.tables[0]
+		if len(table.rows) != test.rows {
+			t.Errorf("%s: %d rows buffered, want %d", test.name, len(table.rows), test.rows)
+		}
+		if table.counts.Skipped != test.skipped {
+			t.Errorf("%s: %d skipped, want %d", test.name, table.counts.Skipped, test.skipped)
+		}
+		if test.last != nil {
+			row := table.rows[len(table.rows) - 1]
+			if row[len(row) - 1] != test.last {
+				t.Errorf("%s: last row ends %v, want %v", test.name, row[len(row) - 1], test.last)
+			}
+		}
+	}
+}
+
+func TestBulkWriterSplitsStatements(t *testing.T) {
+	// keyed has 4 columns, so fits 16383 rows in one statement
+	perStatement := maxBindParameters / 4
+	tests := []struct {
+		name string
+		size int
+		rows int
+		statements []int // rows written by each statement
+	}{
+		{"one row", BulkRows, 1, []int{1}},
+		{"buffer full", 3, 7, []int{3, 3, 1}},
+		{"bind parameter limit", perStatement, perStatement, []int{perStatement}},
+		{"over bind parameter limit", perStatement + 1, perStatement + 1, []int{perStatement, 1}},
+	}
+	for _, test := range tests {
+		db, d := openFakeDB(t)
+		w := NewBulkWriter(test.size)
+		for i := 0; i < test.rows; i++ {
+			if err := w.Write(db, &bulkKeyed{ID: strconv.Itoa(i)}); err != nil {
+				t.Fatal(test.name, err)
+			}
+		}
+		if err := w.Flush(db); err != nil {
+			t.Fatal(test.name, err)
+		}
+
+		inserts := d.matching("INSERT")
+		if len(inserts) != len(test.statements) {
+			t.Fatalf("%s: %d statements, want %d", test.name, len(inserts), len(test.statements))
+		}
+		for i, s := range inserts {
+			if len(s.args) != test.statements[i] * 4 {
+				t.Errorf("%s: statement %d has %d bind parameters, want %d", test.name, i, len(s.args), test.statements[i] * 4)
+			}
+		}
+		counts := w.TakeCounts()["keyed"]
+		if counts.Inserted != test.rows {
+			t.Errorf("%s: %d inserted, want %d", test.name, counts.Inserted, test.rows)
+		}
+		if again := w.TakeCounts(); len(again) != 0 {
+			t.Errorf("%s: counts not reset once taken: %v", test.name, again)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package dataloaders
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+	"github.com/jinzhu/gorm"
+)
+
+// Identifies this run of the loader
+var RunID = time.Now().UTC().Format("20060102T150405") + "-" + strconv.Itoa(os.Getpid())
+
+// Ignore checkpoints left by earlier runs and fetch from the first page
+var Restart = false
+
+// Last page committed by a fetcher from its source, and the run that
+// committed it, so an interrupted load can resume
+type LoadCheckpoint struct {
+	Fetcher string `gorm:"primary_key"`
+	RunID string
+	Page int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Stringer for LoadCheckpoint
+func (p LoadCheckpoint) String() string {
+	return p.Fetcher + " page " + strconv.Itoa(p.Page) + " (run " + p.RunID + ")"
+}
+
+// Name a fetcher's checkpoint is recorded under, so fetching from another
+// source does not resume from a checkpoint left by the last
+func checkpointName(f Fetcher) string {
+	return fmt.Sprint(f) + " " + f.BaseUrl()
+}
+
+// Page a fetcher should start from, resuming after its last checkpoint
+// unless Restart is set
+func StartPage(db *gorm.DB, f Fetcher) (int, error) {
+	if Restart {
+		return 1, ClearCheckpoint(db, f)
+	}
+	cp := LoadCheckpoint{}
+	err := db.Where("fetcher = ?", checkpointName(f)).First(&cp).Error
+	if err == gorm.ErrRecordNotFound {
+		return 1, nil
+	}
+	if err != nil {
+		return 1, err
+	}
+	log.Println("Resuming:", f, "from page", cp.Page + 1, "after run", cp.RunID)
+	return cp.Page + 1, nil
+}
+
+// Removes a fetcher's checkpoint
+func ClearCheckpoint(db *gorm.DB, f Fetcher) error {
+	return db.Where("fetcher = ?", checkpointName(f)).Delete(LoadCheckpoint{}).Error
+}
@@ -0,0 +1,106 @@
+package dataloaders
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Academic year to load, e.g. "2015-16". Blank loads the default sources.
+var Year = ""
+
+// URL templates for each source by name, used to find the source for Year.
+// Placeholders are {year}, e.g. 2015-16, {start}, {end} and {yy}, e.g. 1516.
+var SourceTemplates = make(map[string]string)
+
+// Sources published for each academic year, which need a template when Year
+// is set
+var YearlySources = make(map[string]bool)
+
+// Settings read from a configuration file
+type Config struct {
+	Year string `json:"year"`
+	Sources map[string]string `json:"sources"` // location by source name
+	Templates map[string]string `json:"templates"` // URL template by source name
+}
+
+// Source locations from the configuration file, used if not given by a flag
+// or environment variable
+var configSources = make(map[string]string)
+
+// URL templates from the configuration file, used if not given by a flag or
+// environment variable
+var configTemplates = make(map[string]string)
+
+// Reads a JSON configuration file such as
+//
+//   {"year": "2015-16",
+//    "sources": {"edubase": "/data/edubasealldata.csv"},
+//    "templates": {"ks4": "https://example.org/{year}/england_ks4.csv"}}
+//
+// Settings already given by flags take precedence.
+func LoadConfig(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	config := Config{}
+	if err := json.Unmarshal(b, &config); err != nil {
+		return errors.New("Invalid config " + path + ": " + err.Error())
+	}
+	if Year == "" {
+		Year = config.Year
+	}
+	for name, location := range config.Sources {
+		configSources[name] = location
+	}
+	for name, template := range config.Templates {
+		configTemplates[name] = template
+	}
+	return nil
+}
+
+var academicYearPattern = regexp.MustCompile(`^(\d{4})(?:\s*[-/]\s*(\d{2}|\d{4}))?$`)
+
+// Parses an academic year such as "2015-16", "2015/2016" or "2015", returning
+// the calendar year it starts in
+func ParseAcademicYear(year string) (int, error) {
+	m := academicYearPattern.FindStringSubmatch(strings.TrimSpace(year))
+	if m == nil {
+		return 0, errors.New("Invalid academic year: " + year + ", expected e.g. 2015-16")
+	}
+	start, _ := strconv.Atoi(m[1])
+	if m[2] != "" {
+		end, _ := strconv.Atoi(m[2])
+		if len(m[2]) == 2 {
+			end += start / 100 * 100
+			if end < start {
+				end += 100
+			}
+		}
+		if end != start + 1 {
+			return 0, errors.New("Invalid academic year: " + year + ", the years must be consecutive")
+		}
+	}
+	return start, nil
+}
+
+// Formats the academic year starting in a calendar year, e.g. "2015-16"
+func AcademicYear(start int) string {
+	return fmt.Sprintf("%d-%02d", start, (start + 1) % 100)
+}
+
+// Fills a URL template for the academic year starting in a calendar year
+func expandTemplate(template string, start int) string {
+	end := strconv.Itoa(start + 1)
+	return strings.NewReplacer(
+		"{year}", AcademicYear(start),
+		"{start}", strconv.Itoa(start),
+		"{end}", end,
+		"{yy}", strconv.Itoa(start)[2:] + end[2:],
+	).Replace(template)
+}
@@ -0,0 +1,76 @@
+package dataloaders
+
+import (
+	"testing"
+)
+
+func TestParseAcademicYear(t *testing.T) {
+	tests := []struct {
+		year string
+		start int
+		err bool
+	}{
+		{"2015-16", 2015, false},
+		{"2015/16", 2015, false},
+		{"2015-2016", 2015, false},
+		{" 2015 / 2016 ", 2015, false},
+		{"2015", 2015, false},
+		{"1999-00", 1999, false},
+		{"1999-2000", 1999, false},
+		{"2015-17", 0, true},
+		{"2015-15", 0, true},
+		{"2016-15", 0, true},
+		{"1999-99", 0, true},
+		{"15-16", 0, true},
+		{"2015-6", 0, true},
+		{"", 0, true},
+		{"latest", 0, true},
+	}
+	for _, test := range tests {
+		start, err := ParseAcademicYear(test.year)
+		if (err != nil) != test.err {
+			t.Errorf("ParseAcademicYear(%q) error %v", test.year, err)
+		}
+		if start != test.start {
+			t.Errorf("ParseAcademicYear(%q) = %d, want %d", test.year, start, test.start)
+		}
+	}
+}
+
+func TestAcademicYear(t *testing.T) {
+	tests := []struct {
+		start int
+		year string
+	}{
+		{2015, "2015-16"},
+		{1999, "1999-00"},
+		{2008, "2008-09"},
+	}
+	for _, test := range tests {
+		if year := AcademicYear(test.start); year != test.year {
+			t.Errorf("AcademicYear(%d) = %q, want %q", test.start, year, test.year)
+		}
+		if start, err := ParseAcademicYear(test.year); err != nil || start != test.start {
+			t.Errorf("ParseAcademicYear(%q) = %d, %v, want %d", test.year, start, err, test.start)
+		}
+	}
+}
+
+func TestExpandTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		start int
+		url string
+	}{
+		{"https://example.org/{year}/ks2.csv", 2015, "https://example.org/2015-16/ks2.csv"},
+		{"https://example.org/{start}-{end}/ks4.csv", 2015, "https://example.org/2015-2016/ks4.csv"},
+		{"https://example.org/ks5_{yy}.csv", 2015, "https://example.org/ks5_1516.csv"},
+		{"https://example.org/ks5_{yy}.csv", 1999, "https://example.org/ks5_9900.csv"},
+		{"https://example.org/ks2.csv", 2015, "https://example.org/ks2.csv"},
+	}
+	for _, test := range tests {
+		if url := expandTemplate(test.template, test.start); url != test.url {
+			t.Errorf("expandTemplate(%q, %d) = %q, want %q", test.template, test.start, url, test.url)
+		}
+	}
+}
@@ -0,0 +1,481 @@
+package dataloaders
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"github.com/jinzhu/gorm"
+)
+
+// Converts a CSV value into a value for a model field
+type CSVConverter func(value string) (interface{}, error)
+
+// Converters used for fields by type, unless the field's csv tag names one
+var csvTypeConverters = map[reflect.Type]CSVConverter{
+	reflect.TypeOf(0): func(value string) (interface{}, error) {
+		return strconv.Atoi(value)
+	},
+	reflect.TypeOf(0.0): func(value string) (interface{}, error) {
+		return strconv.ParseFloat(value, 64)
+	},
+	reflect.TypeOf(""): func(value string) (interface{}, error) {
+		return value, nil
+	},
+	reflect.TypeOf(time.Time{}): func(value string) (interface{}, error) {
+		return ParseSimpleDate(value)
+	},
+	reflect.TypeOf((*time.Time)(nil)): func(value string) (interface{}, error) {
+		if strings.TrimSpace(value) == "" {
+			return nil, &MissingValue{Value: value, Status: ValueBlank}
+		}
+		t, err := ParseSimpleDate(value)
+		return &t, err
+	},
+	reflect.TypeOf((*int)(nil)): func(value string) (interface{}, error) {
+		i, err := ParsePerformanceInt(value)
+		return &i, err
+	},
+	reflect.TypeOf((*float64)(nil)): func(value string) (interface{}, error) {
+		f, err := ParsePerformanceFloat(value)
+		return &f, err
+	},
+}
+
+// Converters selected by name in a csv tag, e.g. `csv:"OpenDate,date"`
+var csvNamedConverters = map[string]CSVConverter{
+	"date": func(value string) (interface{}, error) {
+		return ParseSimpleDate(value)
+	},
+}
+
+var csvConvertersMu sync.RWMutex
+
+// Registers a converter that fields can select by name in their csv tag
+func RegisterCSVConverter(name string, c CSVConverter) {
+	csvConvertersMu.Lock()
+	defer csvConvertersMu.Unlock()
+	csvNamedConverters[name] = c
+}
+
+// Implemented by models that need more work once their columns are mapped.
+// Returns any related records to persist before the model.
+type CSVMapped interface {
+	AfterCSVMap() []interface{}
+}
+
+// A model field populated from a CSV column
+type csvField struct {
+	index []int
+	column string
+	dbName string
+	convert CSVConverter
+	key bool
+}
+
+// How a model is populated from CSV columns
+type csvMapping struct {
+	model reflect.Type
+	fields []csvField
+	keyColumn string
+	statuses []int
+	year []int
+}
+
+var (
+	csvMappingsMu sync.Mutex
+	csvMappings = make(map[reflect.Type]*csvMapping)
+)
+
+// Builds the mapping for a model type from its fields' csv tags, e.g.
+// `csv:"URN"` or `csv:"OpenDate,date"` to name a converter
+func csvMappingFor(t reflect.Type) (*csvMapping, error) {
+	csvMappingsMu.Lock()
+	defer csvMappingsMu.Unlock()
+	if m, ok := csvMappings[t]; ok {
+		return m, nil
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, errors.New("CSV model must be a struct: " + t.String())
+	}
+	csvConvertersMu.RLock()
+	defer csvConvertersMu.RUnlock()
+	m := &csvMapping{model: t}
+	if err := m.addFields(t, nil); err != nil {
+		return nil, err
+	}
+	csvMappings[t] = m
+	return m, nil
+}
+
+// Mappings already found by model type, for use by one goroutine without
+// locking
+type csvMappingCache map[reflect.Type]*csvMapping
+
+// Returns the mapping for a model
+func (c csvMappingCache) For(model interface{}) (*csvMapping, error) {
+	t := reflect.TypeOf(model)
+	if m, ok := c[t]; ok {
+		return m, nil
+	}
+	m, err := csvMappingFor(reflect.Indirect(reflect.ValueOf(model)).Type())
+	if err == nil {
+		c[t] = m
+	}
+	return m, err
+}
+
+// Adds the fields of a struct to the mapping, including those of embedded
+// structs without a csv tag
+func (m *csvMapping) addFields(t reflect.Type, prefix []int) error {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		index := append(append([]int{}, prefix...), sf.Index...)
+		tag := sf.Tag.Get("csv")
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct && tag == "" {
+			if err := m.addFields(sf.Type, index); err != nil {
+				return err
+			}
+			continue
+		}
+		if sf.Type == reflect.TypeOf(ValueStatuses{}) {
+			m.statuses = index
+		}
+		if sf.Type == reflect.TypeOf(DatasetYear("")) {
+			m.year = index
+		}
+		if tag == "" || tag == "-" {
+			continue
+		}
+		parts := strings.SplitN(tag, ",", 2)
+		gormTag := sf.Tag.Get("gorm")
+		f := csvField{index: index, column: parts[0], dbName: gorm.ToDBName(sf.Name),
+			key: strings.Contains(gormTag, "primary_key") || strings.Contains(gormTag, "unique_index")}
+		if len(parts) > 1 {
+			f.convert = csvNamedConverters[parts[1]]
+			if f.convert == nil {
+				return errors.New("Unknown CSV converter " + parts[1] + " for " + m.model.Name() + "." + sf.Name)
+			}
+		} else {
+			f.convert = csvTypeConverters[sf.Type]
+			if f.convert == nil {
+				return errors.New("No CSV converter for " + sf.Type.String() + " " + m.model.Name() + "." + sf.Name)
+			}
+		}
+		if f.key {
+			m.keyColumn = f.column
+		}
+		m.fields = append(m.fields, f)
+	}
+	return nil
+}
+
+// Returns the CSV columns the model expects
+func (m *csvMapping) columns() []string {
+	columns := make([]string, len(m.fields))
+	for i, f := range m.fields {
+		columns[i] = f.column
+	}
+	return columns
+}
+
+// Identifies what is loaded into the models from their CSV columns: each
+// model's table, and the column, field and type of each field populated
+func csvRevision(models []interface{}) (string, error) {
+	hash := sha256.New()
+	for _, model := range models {
+		m, err := csvMappingFor(reflect.Indirect(reflect.ValueOf(model)).Type())
+		if err != nil {
+			return "", err
+		}
+		io.WriteString(hash, m.model.String() + "\n")
+		for _, f := range m.fields {
+			field := m.model.FieldByIndex(f.index)
+			io.WriteString(hash, f.column + " " + f.dbName + " " + field.Type.String() + " " + string(field.Tag) + "\n")
+		}
+		if m.year != nil {
+			io.WriteString(hash, "year\n")
+		}
+		if m.statuses != nil {
+			io.WriteString(hash, "statuses\n")
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:16], nil
+}
+
+// Populates a new model from a row. Columns that cannot be converted are left
+// as zero values and returned as errors unless blank or marked as missing;
+// false is returned if the primary key cannot be converted.
+func (m *csvMapping) populate(source string, r CSVRow) (interface{}, []LoadError, bool) {
+	v := reflect.New(m.model)
+	var errs []LoadError
+	if m.year != nil {
+		v.Elem().FieldByIndex(m.year).SetString(LoadingYear())
+	}
+	for _, f := range m.fields {
+		raw := r.Get(f.column)
+		value, err := f.convert(raw)
+		if err != nil {
+			missing, isMissing := err.(*MissingValue)
+			if f.key || (strings.TrimSpace(raw) != "" && (!isMissing || missing.Status == ValueInvalid)) {
+				errs = append(errs, LoadError{RunID: RunID, Source: source, Line: r.Line,
+					Column: f.column, Value: raw, Reason: csvErrorReason(err)})
+			}
+			if f.key {
+				return nil, errs, false
+			}
+			if isMissing && m.statuses != nil {
+				statuses := v.Elem().FieldByIndex(m.statuses)
+				if statuses.IsNil() {
+					statuses.Set(reflect.ValueOf(ValueStatuses{}))
+				}
+				statuses.SetMapIndex(reflect.ValueOf(f.dbName), reflect.ValueOf(missing.Status))
+			}
+			continue
+		}
+		if err := setCSVField(v.Elem().FieldByIndex(f.index), value); err != nil {
+			errs = append(errs, LoadError{RunID: RunID, Source: source, Line: r.Line,
+				Column: f.column, Value: raw, Reason: err.Error()})
+			if f.key {
+				return nil, errs, false
+			}
+		}
+	}
+	return v.Interface(), errs, true
+}
+
+// Sets a field to a converted value, taking its address for a pointer field
+// if need be
+func setCSVField(field reflect.Value, value interface{}) error {
+	rv := reflect.ValueOf(value)
+	if !rv.IsValid() {
+		return nil
+	}
+	if rv.Type().ConvertibleTo(field.Type()) {
+		field.Set(rv.Convert(field.Type()))
+		return nil
+	}
+	if field.Kind() == reflect.Ptr && rv.Type().ConvertibleTo(field.Type().Elem()) {
+		p := reflect.New(field.Type().Elem())
+		p.Elem().Set(rv.Convert(field.Type().Elem()))
+		field.Set(p)
+		return nil
+	}
+	return errors.New("converted to " + rv.Type().String() + ", not " + field.Type().String())
+}
+
+// Describes why a value could not be converted
+func csvErrorReason(err error) string {
+	if missing, ok := err.(*MissingValue); ok {
+		return missing.Status
+	}
+	if _, ok := err.(*strconv.NumError); ok {
+		return "not a number"
+	}
+	if _, ok := err.(*time.ParseError); ok {
+		return "not a date"
+	}
+	return err.Error()
+}
+
+// Loads a CSV source into a model, upserting one record per row populated
+// from the columns named in its csv tags
+func LoadCSV(ctx context.Context, db *gorm.DB, name string, url string, model interface{}) error {
+	return LoadCSVWith(ctx, db, name, url, model, CSVOptions{})
+}
+
+// Changes how LoadCSVWith loads rows
+type CSVOptions struct {
+	// Chooses the model a row is loaded into, or nil to skip the row. By
+	// default every row is loaded into the model given to LoadCSVWith.
+	Route func(r CSVRow) interface{}
+
+	// Rejects a populated row by returning why, e.g. if a record it refers
+	// to does not exist. Rejected rows are recorded in load_errors.
+	Check func(row interface{}) error
+
+	// Other models Route may return. Like the model given to LoadCSVWith,
+	// a change to how they are loaded reloads the source even if unchanged.
+	Models []interface{}
+}
+
+// Loads a CSV source as LoadCSV does, with options. The model's columns are
+// the ones expected in the header.
+func LoadCSVWith(ctx context.Context, db *gorm.DB, name string, url string, model interface{}, options CSVOptions) (err error) {
+	mapping, err := csvMappingFor(reflect.Indirect(reflect.ValueOf(model)).Type())
+
+	if err != nil {
+		return err
+	}
+
+	location, err := SourceLocation(name, url)
+
+	if err != nil {
+		return err
+	}
+
+	revision, err := csvRevision(append([]interface{}{model}, options.Models...))
+
+	if err != nil {
+		return err
+	}
+
+	body, version, err := OpenSource(ctx, db, location, revision)
+
+	if err != nil {
+		return err
+	}
+
+	stats := RunStatsFrom(ctx)
+
+	if body == nil {
+		log.Println("Unchanged since last load, skipping:", location)
+		stats.Source(RunSource{Url: location, Unchanged: true})
+		return nil
+	}
+
+	defer body.Close()
+
+	checksum := newChecksumReader(body)
+	text, err := NewUTF8Reader(checksum, SourceEncoding(name))
+
+	if err != nil {
+		return err
+	}
+
+	records, err := NewCSVReader(text)
+
+	if err != nil {
+		return err
+	}
+
+	err = CheckHeader(db, name, mapping.columns(), records.Header)
+
+	if err != nil {
+		return err
+	}
+
+	header, err := NewSourceHeader(name, records.Header)
+
+	if err != nil {
+		return err
+	}
+
+	batch, err := NewBatch(db, BatchSize)
+
+	if err != nil {
+		return err
+	}
+
+	batch.Stats = stats
+
+	mappings := csvMappingCache{reflect.TypeOf(model): mapping}
+
+	// Errors are written outside the batch so they are kept if it rolls back
+	validation := NewValidation(name)
+	batch.BeforeCommit = validation.CheckSoFar
+	errorWriter := NewBulkWriter(BulkRows)
+	defer func() {
+		if flushErr := errorWriter.Flush(db); flushErr != nil && err == nil {
+			err = flushErr
+		}
+	}()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			batch.Rollback()
+			return err
+		}
+
+		r, err := records.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			batch.Rollback()
+			return err
+		}
+
+		target := model
+		if options.Route != nil {
+			if target = options.Route(r); target == nil {
+				continue
+			}
+		}
+
+		m, err := mappings.For(target)
+		if err != nil {
+			batch.Rollback()
+			return err
+		}
+
+		row, rowErrors, ok := m.populate(name, r)
+		if ok && options.Check != nil {
+			if err := options.Check(row); err != nil {
+				rowErrors = append(rowErrors, LoadError{RunID: RunID, Source: name, Line: r.Line,
+					Column: m.keyColumn, Value: r.Get(m.keyColumn), Reason: err.Error()})
+				ok = false
+			}
+		}
+		validation.Row(rowErrors, !ok)
+		for i := range rowErrors {
+			if err := errorWriter.Write(db, &rowErrors[i]); err != nil {
+				batch.Rollback()
+				return err
+			}
+		}
+		if !ok {
+			log.Println("Invalid " + m.keyColumn + ":", r.Get(m.keyColumn), "Line:", r.Line)
+			stats.Skip(db.NewScope(target).TableName(), 1)
+			continue
+		}
+
+		if mapped, ok := row.(CSVMapped); ok {
+			for _, related := range mapped.AfterCSVMap() {
+				if err := batch.Write(related); err != nil {
+					batch.Rollback()
+					return err
+				}
+			}
+		}
+
+		if err := batch.Write(row); err != nil {
+			batch.Rollback()
+			return err
+		}
+
+		if err := batch.Next(); err != nil {
+			batch.Rollback()
+			return err
+		}
+	}
+
+	if err := validation.Check(); err != nil {
+		batch.Rollback()
+		return err
+	}
+
+	if err := batch.Write(version); err != nil {
+		batch.Rollback()
+		return err
+	}
+
+	if err := batch.Write(header); err != nil {
+		batch.Rollback()
+		return err
+	}
+
+	if err := batch.Commit(); err != nil {
+		return err
+	}
+
+	stats.Source(RunSource{Url: location, Checksum: checksum.Checksum()})
+	return nil
+}
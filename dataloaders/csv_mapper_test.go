@@ -0,0 +1,130 @@
+package dataloaders
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Populated by the CSV mapper in tests
+type csvTestModel struct {
+	URN int `csv:"URN" gorm:"primary_key"`
+	Name string `csv:"NAME"`
+	Opened *time.Time `csv:"OPENDATE"`
+	Closed time.Time `csv:"CLOSEDATE,date"`
+	Pupils *int `csv:"TOTPUPS"`
+	Percentage *float64 `csv:"PTRWM"`
+	Ignored string
+	Statuses ValueStatuses
+}
+
+func TestCSVMappingPopulate(t *testing.T) {
+	m, err := csvMappingFor(reflect.TypeOf(csvTestModel{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if columns := m.columns(); !reflect.DeepEqual(columns, []string{"URN", "NAME", "OPENDATE", "CLOSEDATE", "TOTPUPS", "PTRWM"}) {
+		t.Errorf("columns %v", columns)
+	}
+
+	opened := time.Date(2015, 9, 1, 0, 0, 0, 0, time.UTC)
+	pupils, rounded := 250, 13
+	percentage := 65.5
+	tests := []struct {
+		name string
+		row string
+		ok bool
+		model *csvTestModel // populated, if ok
+		errors []string // columns with load errors
+	}{
+		{"valid", "100,St Mary's,01/09/2015,,250,65.5%", true,
+			&csvTestModel{URN: 100, Name: "St Mary's", Opened: &opened, Pupils: &pupils, Percentage: &percentage}, nil},
+		{"rounded", "100,,,,12.5,", true,
+			&csvTestModel{URN: 100, Pupils: &rounded, Statuses: ValueStatuses{"opened": ValueBlank, "percentage": ValueBlank}}, nil},
+		{"blank", "100,,,,,", true,
+			&csvTestModel{URN: 100, Statuses: ValueStatuses{"opened": ValueBlank, "pupils": ValueBlank, "percentage": ValueBlank}}, nil},
+		{"markers", "100,,,,supp,x", true,
+			&csvTestModel{URN: 100, Statuses: ValueStatuses{"opened": ValueBlank, "pupils": ValueSuppressed, "percentage": ValueNotApplicable}}, nil},
+		{"invalid", "100,,soon,never,lots,", true,
+			&csvTestModel{URN: 100, Statuses: ValueStatuses{"pupils": ValueInvalid, "percentage": ValueBlank}},
+			[]string{"OPENDATE", "CLOSEDATE", "TOTPUPS"}},
+		{"invalid key", "abc,,,,,", false, nil, []string{"URN"}},
+		{"blank key", ",,,,,", false, nil, []string{"URN"}},
+	}
+	for _, test := range tests {
+		records, err := NewCSVReader(strings.NewReader("URN,NAME,OPENDATE,CLOSEDATE,TOTPUPS,PTRWM\n" + test.row + "\n"))
+		if err != nil {
+			t.Fatal(test.name, err)
+		}
+		r, err := records.Read()
+		if err != nil {
+			t.Fatal(test.name, err)
+		}
+
+		row, errs, ok := m.populate("test", r)
+		if ok != test.ok {
+			t.Errorf("%s: ok %v", test.name, ok)
+		}
+		columns := []string{}
+		for _, e := range errs {
+			columns = append(columns, e.Column)
+			if e.Source != "test" || e.Line != r.Line || e.Value != r.Get(e.Column) {
+				t.Errorf("%s: load error %+v", test.name, e)
+			}
+		}
+		if len(columns) != len(test.errors) || len(columns) > 0 && !reflect.DeepEqual(columns, test.errors) {
+			t.Errorf("%s: errors in %v, want %v", test.name, columns, test.errors)
+		}
+		if test.model != nil && !reflect.DeepEqual(row, test.model) {
+			t.Errorf("%s: populated %+v, want %+v", test.name, row, test.model)
+		}
+	}
+}
+
+func TestSetCSVField(t *testing.T) {
+	type fields struct {
+		Int int
+		IntPtr *int
+		Float *float64
+		Year DatasetYear
+	}
+	tests := []struct {
+		name string
+		field string
+		value interface{}
+		want interface{} // field's value afterwards, dereferenced if a pointer
+		err bool
+	}{
+		{"same type", "Int", 3, 3, false},
+		{"into pointer", "IntPtr", 3, 3, false},
+		{"pointer", "IntPtr", intPtr(4), 4, false},
+		{"converted type", "Year", "2015-16", DatasetYear("2015-16"), false},
+		{"converted into pointer", "Float", 2, 2.0, false},
+		{"nil", "IntPtr", nil, nil, false},
+		{"wrong type", "Int", "3", 0, true},
+		{"wrong type for pointer", "Float", time.Time{}, nil, true},
+	}
+	for _, test := range tests {
+		var f fields
+		field := reflect.ValueOf(&f).Elem().FieldByName(test.field)
+		err := setCSVField(field, test.value)
+		if (err != nil) != test.err {
+			t.Errorf("%s: error %v", test.name, err)
+		}
+		got := field.Interface()
+		if field.Kind() == reflect.Ptr {
+			got = nil
+			if !field.IsNil() {
+				got = field.Elem().Interface()
+			}
+		}
+		if got != test.want {
+			t.Errorf("%s: set to %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
@@ -0,0 +1,77 @@
+package dataloaders
+
+import (
+	"encoding/csv"
+	"io"
+	"strings"
+)
+
+// A CSV row whose columns are looked up by header name
+type CSVRow struct {
+	Line int // line of the file the row starts on, counting the header
+	columns map[string]int
+	values []string
+}
+
+// Returns the value in the named column, or an empty string if the row has
+// no such column
+func (r CSVRow) Get(name string) string {
+	if i, ok := r.columns[name]; ok && i < len(r.values) {
+		return r.values[i]
+	}
+	return ""
+}
+
+// Converts the row into a map of header name to value
+func (r CSVRow) Map() map[string]string {
+	m := make(map[string]string, len(r.columns))
+	for name := range r.columns {
+		m[name] = r.Get(name)
+	}
+	return m
+}
+
+// Streams rows from CSV with a header row, holding only one row in memory
+type CSVReader struct {
+	Header []string
+	reader *csv.Reader
+	columns map[string]int
+	line int // last line read
+}
+
+// Reads the header row from r and returns a reader for the remaining rows
+func NewCSVReader(r io.Reader) (*CSVReader, error) {
+	c := &CSVReader{reader: csv.NewReader(r), columns: make(map[string]int)}
+	header, err := c.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	c.Header = header
+	c.line = 1 + newlines(header)
+	for i, name := range header {
+		c.columns[name] = i
+	}
+	return c, nil
+}
+
+// Reads the next row, returning io.EOF after the last
+func (c *CSVReader) Read() (CSVRow, error) {
+	values, err := c.reader.Read()
+	if err != nil {
+		return CSVRow{}, err
+	}
+	line := c.line + 1
+	c.line = line + newlines(values)
+	return CSVRow{Line: line, columns: c.columns, values: values}, nil
+}
+
+// Counts the line breaks within quoted values, each of which starts another
+// line of the file. Blank lines between rows are skipped by encoding/csv so
+// are not counted.
+func newlines(values []string) int {
+	n := 0
+	for _, v := range values {
+		n += strings.Count(v, "\n")
+	}
+	return n
+}
@@ -0,0 +1,42 @@
+package dataloaders
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCSVReaderLines(t *testing.T) {
+	tests := []struct {
+		name string
+		csv string
+		lines []int // line each row starts on
+	}{
+		{"one line rows", "URN,NAME\n1,a\n2,b\n3,c\n", []int{2, 3, 4}},
+		{"crlf", "URN,NAME\r\n1,a\r\n2,b\r\n", []int{2, 3}},
+		{"quoted newline", "URN,NAME\n1,\"a\nb\"\n2,c\n3,\"d\r\n\r\ne\"\n4,f\n", []int{2, 4, 5, 8}},
+		{"quoted newline in header", "URN,\"NAME\nOF SCHOOL\"\n1,a\n", []int{3}},
+		{"no final newline", "URN,NAME\n1,a\n2,b", []int{2, 3}},
+	}
+	for _, test := range tests {
+		records, err := NewCSVReader(strings.NewReader(test.csv))
+		if err != nil {
+			t.Fatal(test.name, err)
+		}
+		lines := []int{}
+		for {
+			r, err := records.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(test.name, err)
+			}
+			lines = append(lines, r.Line)
+		}
+		if !reflect.DeepEqual(lines, test.lines) {
+			t.Errorf("%s: lines %v, want %v", test.name, lines, test.lines)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package dataloaders
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"unicode/utf8"
+)
+
+// Character encodings of source files
+const (
+	EncodingAuto = "auto"
+	EncodingUTF8 = "utf-8"
+	EncodingWindows1252 = "windows-1252"
+	EncodingLatin1 = "iso-8859-1"
+)
+
+// Encoding of each source by name, e.g. "edubase". Sources not listed are
+// detected with EncodingAuto.
+var SourceEncodings = make(map[string]string)
+
+// Returns the encoding declared for a source
+func SourceEncoding(name string) string {
+	if e, ok := SourceEncodings[name]; ok {
+		return e
+	}
+	return EncodingAuto
+}
+
+// Returns the canonical name of an encoding, accepting common aliases
+func NormaliseEncoding(encoding string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "auto":
+		return EncodingAuto, nil
+	case "utf-8", "utf8":
+		return EncodingUTF8, nil
+	case "windows-1252", "cp1252":
+		return EncodingWindows1252, nil
+	case "iso-8859-1", "latin1", "latin-1":
+		return EncodingLatin1, nil
+	}
+	return "", errors.New("Unsupported encoding: " + encoding)
+}
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// Bytes examined when detecting an encoding
+const detectBytes = 64 * 1024
+
+// Wraps r so it is read as UTF-8, skipping any UTF-8 byte order mark. With
+// EncodingAuto the encoding is UTF-8 if there is a byte order mark or the
+// start of the input is valid UTF-8, otherwise Windows-1252. UTF-8 is checked
+// as it is read, failing at the first invalid byte, unless it was detected and
+// only ASCII came before, in which case the rest is read as Windows-1252.
+func NewUTF8Reader(r io.Reader, encoding string) (io.Reader, error) {
+	encoding, err := NormaliseEncoding(encoding)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReaderSize(r, detectBytes)
+	start, err := br.Peek(detectBytes)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(start, utf8BOM) {
+		br.Discard(len(utf8BOM))
+		return &utf8CheckReader{r: br}, nil
+	}
+	if bytes.HasPrefix(start, []byte{0xFF, 0xFE}) || bytes.HasPrefix(start, []byte{0xFE, 0xFF}) {
+		return nil, errors.New("Unsupported encoding: UTF-16")
+	}
+
+	if encoding == EncodingAuto {
+		if validUTF8Prefix(start) {
+			return &utf8CheckReader{r: br, ascii: true}, nil
+		}
+		encoding = EncodingWindows1252
+	}
+
+	switch encoding {
+	case EncodingWindows1252:
+		return &charmapReader{r: br, table: &windows1252}, nil
+	case EncodingLatin1:
+		return &charmapReader{r: br, table: &latin1}, nil
+	}
+	return &utf8CheckReader{r: br}, nil
+}
+
+// Reports whether b is valid UTF-8, allowing a rune cut off at the end
+func validUTF8Prefix(b []byte) bool {
+	for i := 0; i < utf8.UTFMax && len(b) > 0; i++ {
+		if utf8.Valid(b) {
+			return true
+		}
+		b = b[:len(b) - 1]
+	}
+	return utf8.Valid(b)
+}
+
+// Transcodes a single byte encoding to UTF-8
+type charmapReader struct {
+	r *bufio.Reader
+	table *[256]rune
+	pending []byte
+	encoded [utf8.UTFMax]byte
+}
+
+func (c *charmapReader) Read(p []byte) (n int, err error) {
+	for n < len(p) {
+		if len(c.pending) > 0 {
+			copied := copy(p[n:], c.pending)
+			c.pending = c.pending[copied:]
+			n += copied
+			continue
+		}
+		if n > 0 && c.r.Buffered() == 0 {
+			break
+		}
+		b, err := c.r.ReadByte()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+		if b < utf8.RuneSelf {
+			p[n] = b
+			n += 1
+			continue
+		}
+		size := utf8.EncodeRune(c.encoded[:], c.table[b])
+		c.pending = c.encoded[:size]
+	}
+	return n, nil
+}
+
+// Passes through UTF-8, checking it is valid. If ascii is set, reads the rest
+// as Windows-1252 from the first invalid byte if everything before it was
+// ASCII.
+type utf8CheckReader struct {
+	r *bufio.Reader
+	ascii bool // the encoding was detected and everything read so far was ASCII
+	offset int64
+	windows1252 io.Reader // set once switched to Windows-1252
+	pending []byte
+	encoded [utf8.UTFMax]byte
+}
+
+func (u *utf8CheckReader) Read(p []byte) (n int, err error) {
+	for n < len(p) {
+		if len(u.pending) > 0 {
+			copied := copy(p[n:], u.pending)
+			u.pending = u.pending[copied:]
+			n += copied
+			continue
+		}
+		if u.windows1252 != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return u.windows1252.Read(p)
+		}
+		if n > 0 && u.r.Buffered() == 0 {
+			break
+		}
+		r, size, err := u.r.ReadRune()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+		if r == utf8.RuneError && size == 1 {
+			if !u.ascii {
+				return n, fmt.Errorf("Invalid UTF-8 at byte %d", u.offset)
+			}
+			log.Printf("Invalid UTF-8 at byte %d after only ASCII, reading the rest as Windows-1252", u.offset)
+			u.r.UnreadRune()
+			u.windows1252 = &charmapReader{r: u.r, table: &windows1252}
+			continue
+		}
+		u.offset += int64(size)
+		if size == 1 {
+			p[n] = byte(r)
+			n += 1
+			continue
+		}
+		u.ascii = false
+		u.pending = u.encoded[:utf8.EncodeRune(u.encoded[:], r)]
+	}
+	return n, nil
+}
+
+var latin1, windows1252 [256]rune
+
+func init() {
+	for i := range latin1 {
+		latin1[i] = rune(i)
+	}
+	windows1252 = latin1
+	for i, r := range []rune{
+		0x20AC, 0x0081, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021,
+		0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008D, 0x017D, 0x008F,
+		0x0090, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+		0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0x009D, 0x017E, 0x0178,
+	} {
+		windows1252[0x80 + i] = r
+	}
+}
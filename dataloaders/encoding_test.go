@@ -0,0 +1,106 @@
+package dataloaders
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestNewUTF8Reader(t *testing.T) {
+	ascii := strings.Repeat("a", 70000)
+	tests := []struct {
+		name string
+		encoding string
+		input string
+		output string
+		err bool // reading fails
+	}{
+		{"ascii", EncodingAuto, "name,town\n", "name,town\n", false},
+		{"utf-8", EncodingAuto, "St Mary’s £5", "St Mary’s £5", false},
+		{"utf-8 byte order mark", EncodingAuto, "\xEF\xBB\xBFname", "name", false},
+		{"byte order mark overrides declared", EncodingWindows1252, "\xEF\xBB\xBF£", "£", false},
+		{"windows-1252", EncodingWindows1252, "\x80 \x92 \xA3", "€ ’ £", false},
+		{"latin-1", EncodingLatin1, "\x80 \xA3 \xE9", "\u0080 £ é", false},
+		{"detected windows-1252", EncodingAuto, "\xA35 \x80", "£5 €", false},
+		{"windows-1252 after detection", EncodingAuto, ascii + "\xA35", ascii + "£5", false},
+		{"invalid after utf-8", EncodingAuto, "£" + ascii + "\xA3", "", true},
+		{"declared utf-8", EncodingUTF8, "St Mary’s £5", "St Mary’s £5", false},
+		{"invalid declared utf-8", EncodingUTF8, "name\xA3", "", true},
+		{"invalid after byte order mark", EncodingAuto, "\xEF\xBB\xBFname\xA3", "", true},
+	}
+	for _, test := range tests {
+		for _, oneByte := range []bool{false, true} {
+			var in io.Reader = strings.NewReader(test.input)
+			if oneByte {
+				in = iotest.OneByteReader(in)
+			}
+			r, err := NewUTF8Reader(in, test.encoding)
+			if err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+			output, err := ioutil.ReadAll(iotest.OneByteReader(r))
+			if test.err {
+				if err == nil {
+					t.Errorf("%s: no error", test.name)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s: %v", test.name, err)
+			} else if string(output) != test.output {
+				t.Errorf("%s: read %q, want %q", test.name, truncate(output), truncate([]byte(test.output)))
+			}
+		}
+	}
+}
+
+func TestNewUTF8ReaderRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		encoding string
+		input string
+	}{
+		{"utf-16 little endian", EncodingAuto, "\xFF\xFEn\x00"},
+		{"utf-16 big endian", EncodingLatin1, "\xFE\xFF\x00n"},
+		{"unknown encoding", "ebcdic", "name"},
+	}
+	for _, test := range tests {
+		if _, err := NewUTF8Reader(strings.NewReader(test.input), test.encoding); err == nil {
+			t.Errorf("%s: no error", test.name)
+		}
+	}
+}
+
+func TestCharmapReaderShortBuffer(t *testing.T) {
+	// € is 3 bytes in UTF-8, so is split across reads into a smaller buffer
+	r, err := NewUTF8Reader(strings.NewReader("\x80\x80"), EncodingWindows1252)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	p := make([]byte, 2)
+	for {
+		n, err := r.Read(p)
+		b.Write(p[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if b.String() != "€€" {
+		t.Errorf("read %q, want %q", b.String(), "€€")
+	}
+}
+
+// Shortens long test output to its end
+func truncate(b []byte) []byte {
+	if len(b) > 20 {
+		return b[len(b) - 20:]
+	}
+	return b
+}
@@ -0,0 +1,164 @@
+package dataloaders
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+)
+
+// A statement run against a fakeDriver
+type fakeStatement struct {
+	query string
+	args []driver.Value
+}
+
+// Records the statements run through it instead of running them, so code
+// writing to PostgreSQL can be tested without a database. Queries return no
+// rows, except INSERT ... RETURNING which reports each row as inserted.
+type fakeDriver struct {
+	mu sync.Mutex
+	statements []fakeStatement
+	failing string // statements starting with this fail, if set
+}
+
+var (
+	fakeDriversMu sync.Mutex
+	fakeDrivers = 0
+)
+
+// Opens a gorm database using the PostgreSQL dialect over a new fakeDriver
+func openFakeDB(t *testing.T) (*gorm.DB, *fakeDriver) {
+	fakeDriversMu.Lock()
+	fakeDrivers += 1
+	name := "fake" + strconv.Itoa(fakeDrivers)
+	fakeDriversMu.Unlock()
+
+	d := &fakeDriver{}
+	sql.Register(name, d)
+	sqlDB, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open("postgres", sqlDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, d
+}
+
+// Returns the statements run so far whose query starts with prefix
+func (d *fakeDriver) matching(prefix string) []fakeStatement {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	found := []fakeStatement{}
+	for _, s := range d.statements {
+		if strings.HasPrefix(s.query, prefix) {
+			found = append(found, s)
+		}
+	}
+	return found
+}
+
+func (d *fakeDriver) record(query string, args []driver.Value) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.statements = append(d.statements, fakeStatement{query: query, args: args})
+	if d.failing != "" && strings.HasPrefix(query, d.failing) {
+		return errors.New("fake failure: " + query)
+	}
+	return nil
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	return &fakeConn{d}, nil
+}
+
+type fakeConn struct {
+	d *fakeDriver
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{d: c.d, query: query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	if err := c.d.record("BEGIN", nil); err != nil {
+		return nil, err
+	}
+	return &fakeTx{c.d}, nil
+}
+
+type fakeTx struct {
+	d *fakeDriver
+}
+
+func (tx *fakeTx) Commit() error {
+	return tx.d.record("COMMIT", nil)
+}
+
+func (tx *fakeTx) Rollback() error {
+	return tx.d.record("ROLLBACK", nil)
+}
+
+type fakeStmt struct {
+	d *fakeDriver
+	query string
+}
+
+func (s *fakeStmt) Close() error {
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if err := s.d.record(s.query, args); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(0), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if err := s.d.record(s.query, args); err != nil {
+		return nil, err
+	}
+	rows := &fakeRows{}
+	if strings.HasPrefix(s.query, "INSERT") && strings.Contains(s.query, "RETURNING") {
+		rows.remaining = strings.Count(s.query, "($")
+	}
+	return rows, nil
+}
+
+type fakeRows struct {
+	remaining int
+}
+
+func (r *fakeRows) Columns() []string {
+	return []string{"inserted"}
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.remaining < 1 {
+		return io.EOF
+	}
+	r.remaining -= 1
+	dest[0] = true
+	return nil
+}
@@ -1,62 +1,315 @@
 package dataloaders
 
 import (
+	"context"
+	"io"
+	"fmt"
 	"log"
 	"strconv"
+	"strings"
 	"github.com/jinzhu/gorm"
 )
 
 const PerPage = 250
 
-// Fetcher is an interface for fetching JSON data
+// A record that can be written with a Batch
+type Persistable interface {
+	Persist(batch *Batch) error
+}
+
+// Fetcher is an interface for fetching JSON data. Fetchers hold no state
+// between pages so one may be used from several goroutines at once.
+// ParseResults passes each record to fn as it is decoded, stopping at the
+// first error fn returns.
 type Fetcher interface {
 	BaseUrl() string
-	ParseResults(body []byte) (int, error)
-	CreateOrSave(db *gorm.DB, index int) error
+	ParseResults(r io.Reader, fn func(Persistable) error) error
+}
+
+// Pages fetched concurrently by each fetcher
+var Workers = 1
+
+// A fetched page's records waiting to be committed
+type fetchedPage struct {
+	page int
+	records []Persistable
+	err error
 }
 
-// Fetches all pages using a fetcher
-func FetchAll(ch chan<- bool, db *gorm.DB, f Fetcher) {
-	log.Println("Started:", f)
+// Fetches all pages using a fetcher until an empty page is returned,
+// returning the error that stopped it, if any. Up to Workers pages are
+// downloaded and parsed at once but pages are committed in order, each with a
+// checkpoint so an interrupted fetch resumes after the last committed page.
+// Cancelling ctx abandons downloads in progress and stops after the page
+// being committed. Downloads still in progress when it returns are abandoned.
+func FetchAll(ctx context.Context, db *gorm.DB, f Fetcher) error {
+	if !IsPagedSource(f.BaseUrl()) {
+		return FetchSource(ctx, db, f)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	page, err := StartPage(db, f)
+	if err != nil {
+		return fmt.Errorf("%v checkpoint: %v", f, err)
+	}
+	if page == 1 {
+		log.Println("Started:", f)
+	}
+	RunStatsFrom(ctx).Source(RunSource{Url: f.BaseUrl()})
+
+	workers := Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	// limits how far downloads can run ahead of the next page to commit
+	window := make(chan struct{}, workers * 2)
+	pages := make(chan int)
+	go func() {
+		defer close(pages)
+		for p := page; ; p++ {
+			select {
+			case window <- struct{}{}:
+			case <-done:
+				return
+			}
+			select {
+			case pages <- p:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	results := make(chan fetchedPage)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for p := range pages {
+				records, err := FetchPage(ctx, f, p)
+				select {
+				case results <- fetchedPage{page: p, records: records, err: err}:
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
 	total := 0
-	page := 1
+	pending := make(map[int]fetchedPage)
 	for {
-		c, _ := Fetch(db, f, page)
-		if c < 1 {
-			break
+		r := <-results
+		pending[r.page] = r
+		for {
+			next, ok := pending[page]
+			if !ok {
+				break
+			}
+			delete(pending, page)
+			<-window
+
+			c := len(next.records)
+			err := next.err
+			if err == nil {
+				err = ctx.Err()
+			}
+			if err == nil && c > 0 {
+				err = CommitPage(ctx, db, f, page, next.records)
+			}
+			if err != nil {
+				log.Println(f, "Failed on page", page, "after", total, "total:", err)
+				return fmt.Errorf("%v page %d: %v", f, page, err)
+			}
+			if c < 1 {
+				log.Println(f,"Finished:", total, "total")
+				return ClearCheckpoint(db, f)
+			}
+			total += c
+			page += 1
 		}
-		total += c
-		page += 1
 	}
-	log.Println(f,"Finished:", total, "total")
-	ch <- true
+}
+
+// Reports whether a location is an API fetched page by page: an http:// or
+// https:// URL with a query string that is not an archive. Other locations
+// hold the JSON array of one page.
+func IsPagedSource(location string) bool {
+	return IsRemoteSource(location) && !IsArchiveSource(location) && strings.Contains(location, "?")
+}
+
+// Loads a fetcher's source in one go if it cannot be paged, such as a file or
+// an archive, skipping it if unchanged since the last load. Records are
+// written as they are decoded, committing every BatchSize records.
+func FetchSource(ctx context.Context, db *gorm.DB, f Fetcher) error {
+	location := f.BaseUrl()
+	stats := RunStatsFrom(ctx)
+	body, version, err := OpenSource(ctx, db, location, "")
+
+	if err != nil {
+		return fmt.Errorf("%v: %v", f, err)
+	}
+
+	if body == nil {
+		log.Println("Unchanged since last load, skipping:", location)
+		stats.Source(RunSource{Url: location, Unchanged: true})
+		return nil
+	}
+
+	defer body.Close()
+
+	batch, err := NewBatch(db, BatchSize)
+
+	if err != nil {
+		return err
+	}
+
+	references := ReferenceCheckFrom(ctx)
+	batch.Stats = stats
+	batch.OnCommit = func() {
+		references.Committed(stats)
+	}
+
+	total := 0
+	checksum := newChecksumReader(body)
+	err = f.ParseResults(checksum, func(r Persistable) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		total += 1
+		errs := references.Drop(r, total)
+		for i := range errs {
+			if err := batch.Write(&errs[i]); err != nil {
+				return err
+			}
+		}
+		if err := r.Persist(batch); err != nil {
+			return err
+		}
+		return batch.Next()
+	})
+
+	if err != nil {
+		batch.Rollback()
+		return fmt.Errorf("%v record %d: %v", f, total, err)
+	}
+
+	if err := batch.Write(version); err != nil {
+		batch.Rollback()
+		return err
+	}
+
+	if err := batch.Commit(); err != nil {
+		return fmt.Errorf("%v: %v", f, err)
+	}
+
+	log.Println(f, "Finished:", total, "total from", location)
+	stats.Source(RunSource{Url: location, Checksum: checksum.Checksum()})
+	return nil
 }
 
 // Fetches one page with the help of a Fetcher
-func Fetch(db *gorm.DB, f Fetcher, page int) (int, error) {
-	url := f.BaseUrl()  + "&page=" + strconv.Itoa(page) + "&per_page=" + strconv.Itoa(PerPage)
-	body, err := ReadUrl(url)
+//
+// Deprecated: use FetchAll, which resumes from checkpoints.
+func Fetch(ctx context.Context, db *gorm.DB, f Fetcher, page int) (int, error) {
+	records, err := FetchPage(ctx, f, page)
 
 	if err != nil {
 		return 0, err
-	} 
+	}
+
+	if len(records) == 0 {
+		return 0, nil
+	}
+
+	return len(records), CommitPage(ctx, db, f, page, records)
+}
 
-	c, err := f.ParseResults(body)
+// Error for a page not downloaded within HttpPageTimeout
+type pageTimeoutError struct {
+	url string
+}
+
+func (e *pageTimeoutError) Error() string {
+	return e.url + ": not downloaded within " + HttpPageTimeout.String()
+}
+
+func (e *pageTimeoutError) Timeout() bool {
+	return true
+}
+
+func (e *pageTimeoutError) Temporary() bool {
+	return true
+}
+
+// Downloads and parses one page as it is streamed, retrying transient
+// failures and pages taking longer than HttpPageTimeout
+func FetchPage(ctx context.Context, f Fetcher, page int) (records []Persistable, err error) {
+	url := f.BaseUrl()  + "&page=" + strconv.Itoa(page) + "&per_page=" + strconv.Itoa(PerPage)
+	err = Retry(ctx, func() error {
+		attempt, cancel := ctx, context.CancelFunc(func() {})
+		if HttpPageTimeout > 0 {
+			attempt, cancel = context.WithTimeout(ctx, HttpPageTimeout)
+		}
+		defer cancel()
+
+		body, err := OpenUrl(attempt, url)
+		if err == nil {
+			defer body.Close()
+			records = make([]Persistable, 0, PerPage)
+			err = f.ParseResults(body, func(r Persistable) error {
+				records = append(records, r)
+				return nil
+			})
+		}
+		if err != nil && ctx.Err() == nil && attempt.Err() == context.DeadlineExceeded {
+			return &pageTimeoutError{url}
+		}
+		return err
+	})
+	return records, err
+}
+
+// Writes a page's records with a checkpoint in one transaction
+func CommitPage(ctx context.Context, db *gorm.DB, f Fetcher, page int, records []Persistable) error {
+	batch, err := NewBatch(db, 0)
 
 	if err != nil {
-		return 0, err
+		return err
 	}
 
-	tx := db.Begin()
+	batch.Stats = RunStatsFrom(ctx)
+	references := ReferenceCheckFrom(ctx)
 
-	// log.Println("COUNT: ", c)
-	for i := 0; i < c; i++ {
-		err = f.CreateOrSave(db, i)
+	for i, r := range records {
+		errs := references.Drop(r, (page - 1) * PerPage + i + 1)
+		for j := range errs {
+			if err = batch.Write(&errs[j]); err != nil {
+				batch.Rollback()
+				return err
+			}
+		}
+		err = r.Persist(batch)
 		if err != nil {
-			tx.Rollback()
-			return 0, err
+			batch.Rollback()
+			return err
 		}
 	}
-	tx.Commit()
-	return c, nil
-}
\ No newline at end of file
+
+	err = batch.Write(&LoadCheckpoint{Fetcher: checkpointName(f), RunID: RunID, Page: page})
+	if err != nil {
+		batch.Rollback()
+		return err
+	}
+
+	if err = batch.Commit(); err != nil {
+		return err
+	}
+
+	references.Committed(batch.Stats)
+	return nil
+}
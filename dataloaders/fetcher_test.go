@@ -0,0 +1,204 @@
+package dataloaders
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Fetches post code areas from a test server
+type testFetcher struct {
+	url string
+}
+
+func (f testFetcher) String() string {
+	return "Test Fetcher"
+}
+
+func (f testFetcher) BaseUrl() string {
+	return f.url
+}
+
+func (f testFetcher) ParseResults(r io.Reader, fn func(Persistable) error) error {
+	return (&PostCodeAreaFetcher{}).ParseResults(r, fn)
+}
+
+// Serves pages of two areas each, empty after the last page. Earlier pages
+// are slower, so with several workers later pages arrive first. A page in
+// failing returns a server error.
+func pagedServer(pages int, failing int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page == failing {
+			http.Error(w, "failed", http.StatusInternalServerError)
+			return
+		}
+		if page > pages {
+			fmt.Fprint(w, "[]")
+			return
+		}
+		time.Sleep(time.Duration(pages - page) * 5 * time.Millisecond)
+		fmt.Fprintf(w, `[{"@id": "area-%d-1"}, {"@id": "area-%d-2"}]`, page, page)
+	}))
+}
+
+func TestFetchAllCommitsPagesInOrder(t *testing.T) {
+	defer func(workers int, attempts int) {
+		Workers, RetryAttempts = workers, attempts
+	}(Workers, RetryAttempts)
+	RetryAttempts = 1
+
+	tests := []struct {
+		name string
+		workers int
+		pages int
+		failing int // page that fails, or 0
+		committed int // pages committed
+	}{
+		{"one worker", 1, 3, 0, 3},
+		{"several workers", 4, 10, 0, 10},
+		{"more workers than pages", 8, 2, 0, 2},
+		{"failed page", 4, 10, 4, 3},
+		{"first page failed", 4, 10, 1, 0},
+	}
+	for _, test := range tests {
+		server := pagedServer(test.pages, test.failing)
+		db, d := openFakeDB(t)
+		Workers = test.workers
+
+		err := FetchAll(context.Background(), db, testFetcher{server.URL + "/?dataset=postcodes"})
+		server.Close()
+		if (err != nil) != (test.failing > 0) {
+			t.Errorf("%s: error %v", test.name, err)
+		}
+
+		checkpoints := d.matching(`INSERT INTO "load_checkpoints"`)
+		if len(checkpoints) != test.committed {
+			t.Fatalf("%s: %d pages committed, want %d", test.name, len(checkpoints), test.committed)
+		}
+		for i, s := range checkpoints {
+			// fetcher, run_id, page, created_at, updated_at
+			if page := s.args[2]; page != int64(i + 1) {
+				t.Errorf("%s: page %v committed in place of %d", test.name, page, i + 1)
+			}
+		}
+
+		areas := d.matching(`INSERT INTO "post_code_areas"`)
+		for i, s := range areas {
+			want := fmt.Sprintf("area-%d-1", i + 1)
+			if s.args[0] != want {
+				t.Errorf("%s: page %d starts with %v, want %s", test.name, i + 1, s.args[0], want)
+			}
+		}
+
+		cleared := len(d.matching(`DELETE FROM "load_checkpoints"`)) > 0
+		if cleared != (test.failing == 0) {
+			t.Errorf("%s: checkpoint cleared %v", test.name, cleared)
+		}
+	}
+}
+
+func TestFetchAllAbandonsDownloadsOnReturn(t *testing.T) {
+	defer func(workers int) {
+		Workers = workers
+	}(Workers)
+	Workers = 4
+
+	// pages after the empty third page block until their request is cancelled
+	abandoned := make(chan int, 16)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		switch {
+		case page < 3:
+			fmt.Fprintf(w, `[{"@id": "area-%d"}]`, page)
+		case page == 3:
+			time.Sleep(20 * time.Millisecond)
+			fmt.Fprint(w, "[]")
+		default:
+			select {
+			case <-r.Context().Done():
+				abandoned <- page
+			case <-time.After(5 * time.Second):
+			}
+		}
+	}))
+	defer server.Close()
+
+	db, _ := openFakeDB(t)
+	if err := FetchAll(context.Background(), db, testFetcher{server.URL + "/?dataset=postcodes"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-abandoned:
+	case <-time.After(2 * time.Second):
+		t.Error("downloads still in progress once FetchAll returned")
+	}
+}
+
+func TestFetchPageRetriesStalledPages(t *testing.T) {
+	defer func(timeout time.Duration, attempts int, delay time.Duration) {
+		HttpPageTimeout, RetryAttempts, RetryDelay = timeout, attempts, delay
+	}(HttpPageTimeout, RetryAttempts, RetryDelay)
+	HttpPageTimeout, RetryAttempts, RetryDelay = 50 * time.Millisecond, 3, time.Millisecond
+
+	// the first two requests stall part way through the body
+	requests := make(chan int, 8)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- 1
+		if len(requests) > 2 {
+			fmt.Fprint(w, `[{"@id": "area-1"}]`)
+			return
+		}
+		fmt.Fprint(w, `[{"@id": "area-1"}, `)
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	records, err := FetchPage(context.Background(), testFetcher{server.URL + "/?dataset=postcodes"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || len(requests) != 3 {
+		t.Errorf("%d records after %d requests, want 1 after 3", len(records), len(requests))
+	}
+
+	RetryAttempts = 1
+	for len(requests) > 0 {
+		<-requests
+	}
+	_, err = FetchPage(context.Background(), testFetcher{server.URL + "/?dataset=postcodes"}, 1)
+	if _, ok := err.(*pageTimeoutError); !ok || !IsTransient(err) {
+		t.Errorf("error %v, want a transient page timeout", err)
+	}
+}
+
+func TestIsPagedSource(t *testing.T) {
+	tests := []struct {
+		location string
+		paged bool
+	}{
+		{PostCodeUnitUrl, true},
+		{"https://example.org/units.json", false},
+		{"https://example.org/units.json.gz?signature=x", false},
+		{"/data/units.json", false},
+		{"file:///data/units.json?x=1", false},
+	}
+	for _, test := range tests {
+		if paged := IsPagedSource(test.location); paged != test.paged {
+			t.Errorf("IsPagedSource(%q) = %v, want %v", test.location, paged, test.paged)
+		}
+	}
+	if strings.Contains(PostCodeUnitUrl, "&page=") {
+		t.Error("default URL already has a page")
+	}
+}
@@ -0,0 +1,155 @@
+package dataloaders
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+	"github.com/jinzhu/gorm"
+)
+
+// Time allowed to connect to a host, including the TLS handshake
+var HttpConnectTimeout = 30 * time.Second
+
+// Time allowed to wait for a response's headers. Source bodies are streamed
+// while they are loaded so have no overall limit; cancel the context to
+// abandon one.
+var HttpTimeout = 2 * time.Minute
+
+// Time allowed to download and parse one page of a paged source, after which
+// it is retried. Zero or less for no limit.
+var HttpPageTimeout = 5 * time.Minute
+
+// User-Agent sent with every request
+var UserAgent = "datagovuk-loader (+https://github.com/monkeyx/datagovuk-loader)"
+
+// Extra headers sent with every request
+var HttpHeaders = http.Header{}
+
+// Proxy URL for all requests. If blank HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+// from the environment are used.
+var HttpProxy = ""
+
+// Reload sources even if they are unchanged since the last load
+var Force = false
+
+var (
+	httpClientOnce sync.Once
+	httpClient *http.Client
+)
+
+// Returns the HTTP client shared by the data loaders, built from the settings
+// above on first use
+func HttpClient() *http.Client {
+	httpClientOnce.Do(func() {
+		proxy := http.ProxyFromEnvironment
+		if HttpProxy != "" {
+			u, err := url.Parse(HttpProxy)
+			proxy = func(*http.Request) (*url.URL, error) {
+				return u, err
+			}
+		}
+		dialer := &net.Dialer{Timeout: HttpConnectTimeout, KeepAlive: 30 * time.Second}
+		httpClient = &http.Client{Transport: &http.Transport{Proxy: proxy, DialContext: dialer.DialContext,
+			TLSHandshakeTimeout: HttpConnectTimeout, ResponseHeaderTimeout: HttpTimeout,
+			MaxIdleConnsPerHost: 8}}
+	})
+	return httpClient
+}
+
+// Sends a GET request with the configured headers plus any given
+func httpGet(ctx context.Context, rawurl string, header http.Header) (*http.Response, error) {
+	err := WaitForHost(ctx, rawurl)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("GET", rawurl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	for k, v := range HttpHeaders {
+		req.Header[k] = v
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	return HttpClient().Do(req.WithContext(ctx))
+}
+
+// ETag and Last-Modified of a source when it was last loaded. Revision
+// identifies what was loaded from it, so it is reloaded when that changes.
+type SourceVersion struct {
+	Url string `gorm:"primary_key"`
+	ETag string
+	LastModified string
+	Revision string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Stringer for SourceVersion
+func (p SourceVersion) String() string {
+	return p.Url
+}
+
+// Opens a URL for streaming unless it is unchanged since the version
+// recorded in db, in which case the body is nil. The caller must close the
+// body, and should save the returned version once the body has been loaded
+// so the next run can skip it.
+//
+// Deprecated: use OpenSource, which also opens files and archives.
+func OpenUrlIfModified(ctx context.Context, db *gorm.DB, rawurl string) (io.ReadCloser, *SourceVersion, error) {
+	return openUrlVersion(ctx, db, rawurl, rawurl, "")
+}
+
+// Returns the version of a source recorded under key when it was last
+// loaded, or a blank version if Force is set or the source was loaded at
+// another revision
+func previousVersion(db *gorm.DB, key string, revision string) SourceVersion {
+	previous := SourceVersion{}
+	if Force {
+		return previous
+	}
+	db.Where("url = ?", key).First(&previous)
+	if previous.Revision != revision {
+		return SourceVersion{}
+	}
+	return previous
+}
+
+// Opens a URL unless it is unchanged since the version recorded under key
+// at the same revision
+func openUrlVersion(ctx context.Context, db *gorm.DB, rawurl string, key string, revision string) (io.ReadCloser, *SourceVersion, error) {
+	header := http.Header{}
+	previous := previousVersion(db, key, revision)
+	if previous.ETag != "" {
+		header.Set("If-None-Match", previous.ETag)
+	}
+	if previous.LastModified != "" {
+		header.Set("If-Modified-Since", previous.LastModified)
+	}
+
+	resp, err := httpGet(ctx, rawurl, header)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		return nil, nil, nil
+	}
+
+	if resp.StatusCode != 200 {
+		resp.Body.Close()
+		return nil, nil, newHttpError(rawurl, resp)
+	}
+
+	version := &SourceVersion{Url: key, ETag: resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"), Revision: revision}
+
+	return resp.Body, version, nil
+}
@@ -0,0 +1,227 @@
+package dataloaders
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"github.com/jinzhu/gorm"
+)
+
+// A column referring to the id of a row in a parent table
+type ForeignKey struct {
+	Table string
+	Column string
+	Parent string
+}
+
+// Stringer for ForeignKey
+func (k ForeignKey) String() string {
+	return k.Table + "." + k.Column + " -> " + k.Parent
+}
+
+// Name of the constraint enforcing the key
+func (k ForeignKey) constraint() string {
+	return k.Table + "_" + k.Column + "_fkey"
+}
+
+// Rows whose reference to a parent row is broken
+type Orphans struct {
+	Key ForeignKey
+	Count int
+	Examples []string // ids of some of the orphan rows
+}
+
+// Number of orphan ids reported for each foreign key
+const orphanExamples = 5
+
+// Adds constraints enforcing foreign keys. Blank references are made NULL
+// first. Existing rows are not validated, so rows orphaned before the
+// constraints existed are kept until ValidateForeignKeys finds none.
+// Constraints are deferred to the end of each transaction, so a page may be
+// written in any order.
+func AddForeignKeys(tx *gorm.DB, keys []ForeignKey) error {
+	for _, k := range keys {
+		err := execAll(tx,
+			"UPDATE " + k.Table + " SET " + k.Column + " = NULL WHERE " + k.Column + " = ''",
+			"ALTER TABLE " + k.Table + " DROP CONSTRAINT IF EXISTS " + k.constraint(),
+			"ALTER TABLE " + k.Table + " ADD CONSTRAINT " + k.constraint() +
+				" FOREIGN KEY (" + k.Column + ") REFERENCES " + k.Parent + " (id)" +
+				" DEFERRABLE INITIALLY DEFERRED NOT VALID")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Finds rows referring to parent rows that do not exist, logging any found
+func CheckReferences(db *gorm.DB, keys []ForeignKey) ([]Orphans, error) {
+	found := []Orphans{}
+	for _, k := range keys {
+		orphaned := "FROM " + k.Table + " c WHERE c." + k.Column + " IS NOT NULL" +
+			" AND NOT EXISTS (SELECT 1 FROM " + k.Parent + " p WHERE p.id = c." + k.Column + ")"
+
+		o := Orphans{Key: k}
+		if err := db.Raw("SELECT count(*) " + orphaned).Row().Scan(&o.Count); err != nil {
+			return found, err
+		}
+		if o.Count == 0 {
+			continue
+		}
+
+		rows, err := db.Raw("SELECT c.id::text " + orphaned + " ORDER BY c.id LIMIT ?", orphanExamples).Rows()
+		if err != nil {
+			return found, err
+		}
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return found, err
+			}
+			o.Examples = append(o.Examples, id)
+		}
+		rows.Close()
+
+		log.Printf("Integrity: %d rows of %s refer to missing %s, e.g. %s", o.Count, k.Table, k.Parent, strings.Join(o.Examples, ", "))
+		found = append(found, o)
+	}
+	return found, nil
+}
+
+// Validates constraints added by AddForeignKeys, once CheckReferences finds
+// no orphans
+func ValidateForeignKeys(db *gorm.DB, keys []ForeignKey) error {
+	for _, k := range keys {
+		err := db.Exec("ALTER TABLE " + k.Table + " VALIDATE CONSTRAINT " + k.constraint()).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Drops references from the rows of a table to parent rows that do not
+// exist, so a source's orphans are loaded without their parent rather than
+// failing the foreign key. Parent tables must be loaded first. A nil
+// *ReferenceCheck drops nothing.
+type ReferenceCheck struct {
+	source string
+	keys []ForeignKey
+	parents map[string]map[string]bool // ids by parent table
+	fields map[reflect.Type][][]int // index of each key's field, or nil if the model lacks it
+	dropped map[ForeignKey]int // since the last commit
+}
+
+// Reads the ids of the parents a table's rows may refer to through keys
+func NewReferenceCheck(db *gorm.DB, source string, table string, keys []ForeignKey) (*ReferenceCheck, error) {
+	c := &ReferenceCheck{source: source, parents: make(map[string]map[string]bool),
+		fields: make(map[reflect.Type][][]int), dropped: make(map[ForeignKey]int)}
+	for _, k := range keys {
+		if k.Table != table {
+			continue
+		}
+		c.keys = append(c.keys, k)
+		if _, ok := c.parents[k.Parent]; ok {
+			continue
+		}
+		ids := []string{}
+		if err := db.Table(k.Parent).Pluck("id", &ids).Error; err != nil {
+			return nil, err
+		}
+		c.parents[k.Parent] = make(map[string]bool, len(ids))
+		for _, id := range ids {
+			c.parents[k.Parent][id] = true
+		}
+	}
+	return c, nil
+}
+
+// Finds the fields of a model holding each key, by column name
+func (c *ReferenceCheck) fieldsOf(t reflect.Type) [][]int {
+	if indexes, ok := c.fields[t]; ok {
+		return indexes
+	}
+	indexes := make([][]int, len(c.keys))
+	for i, k := range c.keys {
+		if sf, ok := t.FieldByNameFunc(func(name string) bool { return gorm.ToDBName(name) == k.Column }); ok {
+			indexes[i] = sf.Index
+		}
+	}
+	c.fields[t] = indexes
+	return indexes
+}
+
+// Sets a record's references to missing parents to NULL, returning a load
+// error for each. JSON sources have no lines, so line numbers the record
+// within its source.
+func (c *ReferenceCheck) Drop(record interface{}, line int) []LoadError {
+	if c == nil || len(c.keys) == 0 {
+		return nil
+	}
+	v := reflect.Indirect(reflect.ValueOf(record))
+	var errs []LoadError
+	for i, index := range c.fieldsOf(v.Type()) {
+		if index == nil {
+			continue
+		}
+		field := v.FieldByIndex(index)
+		var id string
+		switch {
+		case field.Kind() == reflect.Ptr && !field.IsNil():
+			id = field.Elem().String()
+		case field.Kind() == reflect.String:
+			id = field.String()
+		}
+		k := c.keys[i]
+		if id == "" || c.parents[k.Parent][id] {
+			continue
+		}
+		field.Set(reflect.Zero(field.Type()))
+		c.dropped[k] += 1
+		errs = append(errs, LoadError{RunID: RunID, Source: c.source, Line: line,
+			Column: k.Column, Value: id, Reason: "no row in " + k.Parent + " with this id"})
+	}
+	return errs
+}
+
+// Adds the references dropped since the last commit to stats
+func (c *ReferenceCheck) Committed(stats *RunStats) {
+	if c == nil {
+		return
+	}
+	for k, n := range c.dropped {
+		stats.Orphans(k, OrphanCounts{Dropped: n})
+	}
+	c.dropped = make(map[ForeignKey]int)
+}
+
+type referenceCheckKey struct{}
+
+// Returns a context carrying a check for fetchers to drop missing references
+// with
+func WithReferenceCheck(ctx context.Context, c *ReferenceCheck) context.Context {
+	return context.WithValue(ctx, referenceCheckKey{}, c)
+}
+
+// Returns the check carried by ctx, or nil
+func ReferenceCheckFrom(ctx context.Context) *ReferenceCheck {
+	c, _ := ctx.Value(referenceCheckKey{}).(*ReferenceCheck)
+	return c
+}
+
+// Records the orphans found by CheckReferences in stats, returning an error
+// listing them if there are any
+func ReportOrphans(stats *RunStats, orphans []Orphans) error {
+	if len(orphans) == 0 {
+		return nil
+	}
+	found := make([]string, len(orphans))
+	for i, o := range orphans {
+		stats.Orphans(o.Key, OrphanCounts{Remaining: o.Count})
+		found[i] = fmt.Sprintf("%d rows of %s (e.g. %s)", o.Count, o.Key, strings.Join(o.Examples, ", "))
+	}
+	return fmt.Errorf("Rows refer to missing parents: %s", strings.Join(found, "; "))
+}
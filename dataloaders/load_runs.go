@@ -0,0 +1,266 @@
+package dataloaders
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+	"github.com/jinzhu/gorm"
+)
+
+// Status of a load run
+const (
+	RunRunning = "running"
+	RunSucceeded = "succeeded"
+	RunFailed = "failed"
+	RunInterrupted = "interrupted"
+)
+
+// Records one run of a data loader
+type LoadRun struct {
+	ID uint `gorm:"primary_key"`
+	RunID string `gorm:"index"`
+	Loader string `gorm:"index"`
+	StartedAt time.Time
+	FinishedAt *time.Time
+	Status string
+	Error string `gorm:"type:text"`
+	Sources string `gorm:"type:jsonb"` // JSON array of RunSource
+	RowCounts string `gorm:"type:jsonb"` // JSON object of table name to RowCounts
+	Orphans string `gorm:"type:jsonb"` // JSON object of foreign key to OrphanCounts
+}
+
+// Stringer for LoadRun
+func (p LoadRun) String() string {
+	return p.Loader + " run " + strconv.Itoa(int(p.ID)) + " (" + p.Status + ")"
+}
+
+// A source fetched by a load run
+type RunSource struct {
+	Url string `json:"url"`
+	Checksum string `json:"checksum,omitempty"` // SHA-256 of the data as loaded, after decompression
+	Unchanged bool `json:"unchanged,omitempty"` // skipped as unchanged since the last load
+}
+
+// Rows written to a table by a load run. Skipped rows were rejected, or
+// replaced by a later row with the same key before being written.
+type RowCounts struct {
+	Inserted int `json:"inserted"`
+	Updated int `json:"updated"`
+	Skipped int `json:"skipped"`
+}
+
+// References to missing parent rows found by a load run through a foreign key
+type OrphanCounts struct {
+	Dropped int `json:"dropped"` // set to NULL as rows were loaded
+	Remaining int `json:"remaining"` // rows still referring to a missing parent after the load
+}
+
+// Collects the sources, row counts and orphans of a load run. A nil *RunStats ignores
+// everything recorded, so loaders need not check for one.
+type RunStats struct {
+	mu sync.Mutex
+	sources []RunSource
+	tables map[string]*RowCounts
+	orphans map[string]*OrphanCounts
+}
+
+type runStatsKey struct{}
+
+// Returns a context carrying stats for the loader to record into
+func WithRunStats(ctx context.Context, stats *RunStats) context.Context {
+	return context.WithValue(ctx, runStatsKey{}, stats)
+}
+
+// Returns the stats carried by ctx, or nil
+func RunStatsFrom(ctx context.Context) *RunStats {
+	stats, _ := ctx.Value(runStatsKey{}).(*RunStats)
+	return stats
+}
+
+// Records a fetched source
+func (s *RunStats) Source(source RunSource) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sources = append(s.sources, source)
+}
+
+// Adds committed row counts by table name
+func (s *RunStats) Add(counts map[string]RowCounts) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tables == nil {
+		s.tables = make(map[string]*RowCounts)
+	}
+	for table, c := range counts {
+		total, ok := s.tables[table]
+		if !ok {
+			total = &RowCounts{}
+			s.tables[table] = total
+		}
+		total.Inserted += c.Inserted
+		total.Updated += c.Updated
+		total.Skipped += c.Skipped
+	}
+}
+
+// Counts rows of a table that were not written
+func (s *RunStats) Skip(table string, rows int) {
+	s.Add(map[string]RowCounts{table: {Skipped: rows}})
+}
+
+// Adds orphans found through a foreign key
+func (s *RunStats) Orphans(key ForeignKey, counts OrphanCounts) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.orphans == nil {
+		s.orphans = make(map[string]*OrphanCounts)
+	}
+	total, ok := s.orphans[key.String()]
+	if !ok {
+		total = &OrphanCounts{}
+		s.orphans[key.String()] = total
+	}
+	total.Dropped += counts.Dropped
+	total.Remaining += counts.Remaining
+}
+
+func (s *RunStats) json() (sources string, tables string, orphans string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := s.sources
+	if list == nil {
+		list = []RunSource{}
+	}
+	b, err := json.Marshal(list)
+	if err != nil {
+		return "", "", "", err
+	}
+	counts := s.tables
+	if counts == nil {
+		counts = map[string]*RowCounts{}
+	}
+	c, err := json.Marshal(counts)
+	if err != nil {
+		return "", "", "", err
+	}
+	found := s.orphans
+	if found == nil {
+		found = map[string]*OrphanCounts{}
+	}
+	o, err := json.Marshal(found)
+	return string(b), string(c), string(o), err
+}
+
+// Hashes a source body as it is read
+type checksumReader struct {
+	r io.Reader
+	hash hash.Hash
+}
+
+func newChecksumReader(r io.Reader) *checksumReader {
+	return &checksumReader{r: r, hash: sha256.New()}
+}
+
+func (c *checksumReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.hash.Write(p[:n])
+	return n, err
+}
+
+// Returns the checksum of everything read so far
+func (c *checksumReader) Checksum() string {
+	return "sha256:" + hex.EncodeToString(c.hash.Sum(nil))
+}
+
+// Runs a registered data loader, recording the run in load_runs
+func Run(ctx context.Context, db *gorm.DB, r Registration) error {
+	if err := db.AutoMigrate(&LoadRun{}).Error; err != nil {
+		return err
+	}
+
+	run := LoadRun{RunID: RunID, Loader: r.Name, StartedAt: time.Now(), Status: RunRunning,
+		Sources: "[]", RowCounts: "{}", Orphans: "{}"}
+	if err := db.Create(&run).Error; err != nil {
+		return err
+	}
+
+	stats := &RunStats{}
+	err := r.Loader.Load(WithRunStats(ctx, stats), db)
+
+	finished := time.Now()
+	run.FinishedAt = &finished
+	switch {
+	case ctx.Err() != nil:
+		run.Status = RunInterrupted
+	case err != nil:
+		run.Status = RunFailed
+	default:
+		run.Status = RunSucceeded
+	}
+	if err != nil {
+		run.Error = err.Error()
+	}
+	sources, tables, orphans, jsonErr := stats.json()
+	if jsonErr == nil {
+		run.Sources, run.RowCounts, run.Orphans = sources, tables, orphans
+	}
+
+	if saveErr := db.Save(&run).Error; saveErr != nil && err == nil {
+		return saveErr
+	}
+	return err
+}
+
+// Returns the most recent load runs, newest first, optionally only those of
+// one loader
+func History(db *gorm.DB, loader string, limit int) ([]LoadRun, error) {
+	runs := []LoadRun{}
+	if err := db.AutoMigrate(&LoadRun{}).Error; err != nil {
+		return runs, err
+	}
+	query := db.Order("started_at desc, id desc")
+	if loader != "" {
+		query = query.Where("loader = ?", loader)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	err := query.Find(&runs).Error
+	return runs, err
+}
+
+// Returns the row counts recorded for a run by table name
+func (p LoadRun) Counts() map[string]RowCounts {
+	counts := make(map[string]RowCounts)
+	json.Unmarshal([]byte(p.RowCounts), &counts)
+	return counts
+}
+
+// Returns the orphans recorded for a run by foreign key
+func (p LoadRun) OrphanCounts() map[string]OrphanCounts {
+	orphans := make(map[string]OrphanCounts)
+	json.Unmarshal([]byte(p.Orphans), &orphans)
+	return orphans
+}
+
+// Returns the sources recorded for a run
+func (p LoadRun) FetchedSources() []RunSource {
+	var sources []RunSource
+	json.Unmarshal([]byte(p.Sources), &sources)
+	return sources
+}
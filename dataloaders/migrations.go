@@ -0,0 +1,54 @@
+package dataloaders
+
+import (
+	"log"
+	"time"
+	"github.com/jinzhu/gorm"
+)
+
+// Records a one-off migration that has been applied
+type SchemaMigration struct {
+	ID string `gorm:"primary_key"`
+	CreatedAt time.Time
+}
+
+// Runs a one-off migration in a transaction unless it has already been
+// applied, recording it under id so it is not run again
+func Migrate(db *gorm.DB, id string, fn func(tx *gorm.DB) error) error {
+	if err := db.AutoMigrate(&SchemaMigration{}).Error; err != nil {
+		return err
+	}
+
+	err := db.Where("id = ?", id).First(&SchemaMigration{}).Error
+	if err == nil {
+		return nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return err
+	}
+
+	tx := db.Begin()
+	if err := tx.Error; err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Create(&SchemaMigration{ID: id}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	log.Println("Applied migration:", id)
+	return tx.Commit().Error
+}
+
+// Runs each SQL statement of a migration in order
+func execAll(tx *gorm.DB, statements ...string) error {
+	for _, sql := range statements {
+		if err := tx.Exec(sql).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
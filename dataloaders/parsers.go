@@ -1,57 +1,93 @@
 package dataloaders
 
 import (
+	"context"
 	"bytes"
 	"encoding/json"
-	"encoding/csv"
-	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
-	"net/http"
 	"time"
 )
 
-// Reads a URL into a byte slice
-func ReadUrl(url string) ([]byte, error) {
-	resp, err := http.Get(url)
+// Reads a URL into a byte slice, abandoning the request if ctx is cancelled.
+//
+// Deprecated: holds the whole body in memory; stream it with OpenUrl instead.
+func ReadUrl(ctx context.Context, url string) ([]byte, error) {
+	body, err := OpenUrl(ctx, url)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	defer body.Close()
 
-	if resp.StatusCode != 200 {
-		return nil, errors.New(url + ": " + resp.Status)
-	}
+	return ioutil.ReadAll(body)
+}
 
-	body, err := ioutil.ReadAll(resp.Body)
+// Opens a URL for streaming, abandoning the request if ctx is cancelled. The
+// caller must close the body.
+func OpenUrl(ctx context.Context, url string) (io.ReadCloser, error) {
+	resp, err := httpGet(ctx, url, nil)
+	if err != nil {
+		return nil, err
+	}
 
-	// log.Println(url + ":", string(body))
+	if resp.StatusCode != 200 {
+		resp.Body.Close()
+		return nil, newHttpError(url, resp)
+	}
 
-	return body, err
+	return resp.Body, nil
 }
 
 // Parses JSON into interface
+//
+// Deprecated: use encoding/json, or DecodeJSONArray to stream an array.
 func ParseJSON(body []byte, v interface{}) error {
 	return json.Unmarshal(body, v)
 }
 
-// Parses CSV into a slice of maps using the header row to determine the keys
+// Decodes a JSON array from r one element at a time as it is read, calling
+// fn with the decoder positioned at each element so only one element needs
+// to be held in memory
+func DecodeJSONArray(r io.Reader, fn func(dec *json.Decoder) error) error {
+	dec := json.NewDecoder(r)
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("Expected JSON array but found %v", tok)
+	}
+	for dec.More() {
+		if err := fn(dec); err != nil {
+			return err
+		}
+	}
+	_, err = dec.Token()
+	return err
+}
+
+// Parses CSV into a slice of maps using the header row to determine the keys.
+//
+// Deprecated: holds every row in memory; stream rows with a CSVReader instead.
 func ParseCSV(body []byte) ([]map[string]string, error) {
 	slice := make([]map[string]string, 0)
-	records, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+	records, err := NewCSVReader(bytes.NewReader(body))
 
 	if err != nil {
 		return slice, err
 	}
 
-	rows := len(records)
-	for i := 1; i < rows; i++ {
-		m := make(map[string]string)
-		cols := len(records[i])
-		for j := 0; j < cols; j++ {
-			m[records[0][j]] = records[i][j]
+	for {
+		r, err := records.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return slice, err
 		}
-		slice = append(slice, m)
+		slice = append(slice, r.Map())
 	}
 
 	return slice, nil
@@ -0,0 +1,125 @@
+package dataloaders
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"github.com/jinzhu/gorm"
+)
+
+// Why a performance value is missing
+const (
+	ValueSuppressed = "suppressed" // SUPP, too few pupils to publish
+	ValueNotEntered = "not entered" // NE
+	ValueNotPublished = "not published" // NP
+	ValueLowCoverage = "low coverage" // LOWCOV
+	ValueNewSchool = "new school" // NEW
+	ValueNotApplicable = "not applicable" // NA or x
+	ValueBlank = "blank"
+	ValueInvalid = "invalid"
+)
+
+// Markers DfE performance tables use in place of numbers, in upper case as
+// they are matched regardless of case
+var missingValueMarkers = map[string]string{
+	"SUPP": ValueSuppressed,
+	"NE": ValueNotEntered,
+	"NP": ValueNotPublished,
+	"LOWCOV": ValueLowCoverage,
+	"NEW": ValueNewSchool,
+	"NA": ValueNotApplicable,
+	"X": ValueNotApplicable,
+	"": ValueBlank,
+}
+
+// Error for a performance value that is missing or not a number
+type MissingValue struct {
+	Value string
+	Status string
+}
+
+func (e *MissingValue) Error() string {
+	return "Missing value " + strconv.Quote(e.Value) + ": " + e.Status
+}
+
+// Parses a performance table number, stripping any % suffix. Markers such as
+// SUPP or NE and values that are not numbers return a *MissingValue.
+func ParsePerformanceFloat(value string) (float64, error) {
+	value = strings.TrimSpace(value)
+	if status, ok := missingValueMarkers[strings.ToUpper(value)]; ok {
+		return 0, &MissingValue{Value: value, Status: status}
+	}
+	f, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+	if err != nil {
+		return 0, &MissingValue{Value: value, Status: ValueInvalid}
+	}
+	return f, nil
+}
+
+// Parses a performance table whole number as ParsePerformanceFloat does,
+// rounding any decimals. Percentages are parsed with ParsePerformanceFloat
+// so their decimals are kept.
+func ParsePerformanceInt(value string) (int, error) {
+	f, err := ParsePerformanceFloat(value)
+	if err != nil {
+		return 0, err
+	}
+	return int(math.Floor(f + 0.5)), nil
+}
+
+// Why each missing value in a record is absent, by column name
+type ValueStatuses map[string]string
+
+// Stores the statuses as JSON, or NULL if there are none
+func (v ValueStatuses) Value() (driver.Value, error) {
+	if len(v) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(map[string]string(v))
+	return string(b), err
+}
+
+// Reads statuses stored as JSON
+func (v *ValueStatuses) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case nil:
+		*v = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(s, (*map[string]string)(v))
+	case string:
+		return json.Unmarshal([]byte(s), (*map[string]string)(v))
+	}
+	return errors.New("Cannot scan value statuses")
+}
+
+// Changes the columns of decimal performance figures, such as percentages,
+// created as integers by earlier versions to the type of their field. The
+// time series views depend on them, so are dropped to be created again.
+func migratePerformanceDecimals(tx *gorm.DB) error {
+	for _, series := range performanceSeries {
+		if err := tx.Exec("DROP VIEW IF EXISTS " + series.view).Error; err != nil {
+			return err
+		}
+	}
+	models := []interface{}{&SchoolKeyStage2{}, &LocalAuthorityKeyStage2{}, &NationalKeyStage2{},
+		&SchoolKeyStage4{}, &SchoolKeyStage5{}}
+	for _, model := range models {
+		scope := tx.NewScope(model)
+		for _, field := range scope.GetModelStruct().StructFields {
+			if field.Struct.Type != reflect.TypeOf((*float64)(nil)) {
+				continue
+			}
+			err := tx.Exec("ALTER TABLE " + scope.TableName() + " ALTER COLUMN " + field.DBName +
+				" TYPE " + scope.Dialect().DataTypeOf(field)).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package dataloaders
+
+import (
+	"testing"
+)
+
+func TestParsePerformanceFloat(t *testing.T) {
+	tests := []struct {
+		value string
+		f float64
+		status string // of the *MissingValue returned, if any
+	}{
+		{"65.5", 65.5, ""},
+		{"65.5%", 65.5, ""},
+		{" 100% ", 100, ""},
+		{"-0.25", -0.25, ""},
+		{"0", 0, ""},
+		{"", 0, ValueBlank},
+		{"  ", 0, ValueBlank},
+		{"SUPP", 0, ValueSuppressed},
+		{"supp", 0, ValueSuppressed},
+		{"NE", 0, ValueNotEntered},
+		{"np", 0, ValueNotPublished},
+		{"LOWCOV", 0, ValueLowCoverage},
+		{"LowCov", 0, ValueLowCoverage},
+		{"NEW", 0, ValueNewSchool},
+		{"NA", 0, ValueNotApplicable},
+		{"x", 0, ValueNotApplicable},
+		{"X", 0, ValueNotApplicable},
+		{"%", 0, ValueInvalid},
+		{"12%%", 0, ValueInvalid},
+		{"n/a", 0, ValueInvalid},
+	}
+	for _, test := range tests {
+		f, err := ParsePerformanceFloat(test.value)
+		checkMissingValue(t, "ParsePerformanceFloat", test.value, err, test.status)
+		if f != test.f {
+			t.Errorf("ParsePerformanceFloat(%q) = %v, want %v", test.value, f, test.f)
+		}
+	}
+}
+
+func TestParsePerformanceInt(t *testing.T) {
+	tests := []struct {
+		value string
+		i int
+		status string
+	}{
+		{"250", 250, ""},
+		{"12.4", 12, ""},
+		{"12.5", 13, ""},
+		{"12.6", 13, ""},
+		{"-1.5", -1, ""},
+		{"80%", 80, ""},
+		{"", 0, ValueBlank},
+		{"Supp", 0, ValueSuppressed},
+		{"ten", 0, ValueInvalid},
+	}
+	for _, test := range tests {
+		i, err := ParsePerformanceInt(test.value)
+		checkMissingValue(t, "ParsePerformanceInt", test.value, err, test.status)
+		if i != test.i {
+			t.Errorf("ParsePerformanceInt(%q) = %d, want %d", test.value, i, test.i)
+		}
+	}
+}
+
+// Checks err is a *MissingValue of the status and value, or nil if status is
+// empty
+func checkMissingValue(t *testing.T, parser string, value string, err error, status string) {
+	if status == "" {
+		if err != nil {
+			t.Errorf("%s(%q) error %v", parser, value, err)
+		}
+		return
+	}
+	missing, ok := err.(*MissingValue)
+	if !ok {
+		t.Errorf("%s(%q) error %v, want status %s", parser, value, err, status)
+		return
+	}
+	if missing.Status != status || missing.Value != value && missing.Value != "" {
+		t.Errorf("%s(%q) missing %q: %s, want %s", parser, value, missing.Value, missing.Status, status)
+	}
+}
+
+func TestValueStatusesValue(t *testing.T) {
+	tests := []struct {
+		statuses ValueStatuses
+		value interface{}
+	}{
+		{nil, nil},
+		{ValueStatuses{}, nil},
+		{ValueStatuses{"pupils": ValueSuppressed}, `{"pupils":"suppressed"}`},
+	}
+	for _, test := range tests {
+		value, err := test.statuses.Value()
+		if err != nil || value != test.value {
+			t.Errorf("%v.Value() = %v, %v, want %v", test.statuses, value, err, test.value)
+		}
+		var scanned ValueStatuses
+		if err := scanned.Scan(value); err != nil || len(scanned) != len(test.statuses) {
+			t.Errorf("Scan(%v) = %v, %v", value, scanned, err)
+		}
+	}
+}
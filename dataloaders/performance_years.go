@@ -0,0 +1,96 @@
+package dataloaders
+
+import (
+	"strings"
+	"github.com/jinzhu/gorm"
+)
+
+// Academic year covered by the default sources
+const DefaultYear = "2014-15"
+
+// Academic year a performance record covers, e.g. "2015-16". A model field of
+// this type is set by LoadCSV to the year being loaded.
+type DatasetYear string
+
+// Returns the academic year being loaded. Without Year the default sources
+// are loaded, as SourceLocation refuses other locations for yearly sources.
+func LoadingYear() string {
+	if Year == "" {
+		return DefaultYear
+	}
+	return Year
+}
+
+// Performance tables keyed by school and academic year
+var performanceModels = []interface{}{&SchoolKeyStage2{}, &SchoolKeyStage4{}, &SchoolKeyStage5{}}
+
+// Adds the academic year to the primary key of performance tables created
+// when they were keyed by school alone, assigning existing rows to the year of
+// the default sources
+func migratePerformanceYears(tx *gorm.DB) error {
+	for _, model := range performanceModels {
+		table := tx.NewScope(model).TableName()
+		err := execAll(tx,
+			"UPDATE " + table + " SET academic_year = '" + DefaultYear + "' WHERE academic_year IS NULL OR academic_year = ''",
+			"ALTER TABLE " + table + " ALTER COLUMN academic_year SET NOT NULL",
+			"ALTER TABLE " + table + " DROP CONSTRAINT IF EXISTS " + table + "_pkey",
+			"ALTER TABLE " + table + " ADD PRIMARY KEY (id, academic_year)")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Headline measures of each performance table shown in its time series view
+var performanceSeries = []struct {
+	view string
+	model interface{}
+	school string // column holding the URN
+	fields []string
+}{
+	{"school_key_stage_2_series", &SchoolKeyStage2{}, "school_id",
+		[]string{"PercentageLevel4Minimum", "PercentageLevel5Minimum", "AveragePointScore", "AverageValueAdded"}},
+	{"school_key_stage_4_series", &SchoolKeyStage4{}, "id",
+		[]string{"PercentageFiveGCSEsEnglishMaths", "AverageAttainment8", "AverageProgress8", "GapAttainment8"}},
+	{"school_key_stage_5_series", &SchoolKeyStage5{}, "id",
+		[]string{"AveragePointScoreALevel", "AveragePointScoreAcademic", "ValueAddedALevel", "PercentageDestinationEducationEmployment"}},
+}
+
+// Creates a view for each performance table listing each school's headline
+// measures by academic year, with the change in each since the school's
+// previous year
+func CreatePerformanceViews(db *gorm.DB) error {
+	for _, series := range performanceSeries {
+		scope := db.NewScope(series.model)
+		school := "p." + series.school
+		columns := []string{school + " AS school_id", "s.establishment_name", "p.local_authority_id", "p.academic_year"}
+		for _, name := range series.fields {
+			field, ok := scope.FieldByName(name)
+			if !ok {
+				continue
+			}
+			column := field.DBName
+			columns = append(columns, "p." + column,
+				"p." + column + " - lag(p." + column + ") OVER (PARTITION BY " + school + " ORDER BY p.academic_year) AS " + column + "_change")
+		}
+		err := execAll(db,
+			"DROP VIEW IF EXISTS " + series.view,
+			"CREATE VIEW " + series.view + " AS SELECT " + strings.Join(columns, ", ") +
+				" FROM " + scope.TableName() + " p LEFT JOIN schools s ON s.id = " + school)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Finds a school's performance records in order of academic year, e.g.
+// SchoolPerformanceSeries(db, urn, &[]SchoolKeyStage4{})
+func SchoolPerformanceSeries(db *gorm.DB, urn int, records interface{}) error {
+	column := "id"
+	if _, ok := db.NewScope(records).FieldByName("SchoolID"); ok {
+		column = "school_id"
+	}
+	return db.Where(column + " = ?", urn).Order("academic_year").Find(records).Error
+}
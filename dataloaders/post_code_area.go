@@ -1,9 +1,8 @@
 package dataloaders
 
 import (
-	"errors"
-	"github.com/jinzhu/gorm"
-	"strconv"
+	"encoding/json"
+	"io"
 	"time"
 )
 
@@ -21,6 +20,11 @@ func (p PostCodeAreaResponse) String() string {
 	return p.Id
 }
 
+// Converts the response into a database model
+func (r PostCodeAreaResponse) Model() *PostCodeArea {
+	return &PostCodeArea{ID: r.Id, Label: FirstOrEmptyXmlValue(r.Labels)}
+}
+
 // PostCode unit database model
 type PostCodeArea struct {
 	ID string `gorm:"primary_key"`
@@ -35,10 +39,14 @@ func (p PostCodeArea) String() string {
 	return p.ID
 }
 
+// Persist using a batch
+func (p *PostCodeArea) Persist(batch *Batch) error {
+	return batch.Write(p)
+}
+
 // PostCodeArea fetcher
 type PostCodeAreaFetcher struct {
-	Results []PostCodeAreaResponse
-	TotalResults int
+	Url string // fetched in place of PostCodeAreaUrl, if set
 }
 
 // Stringer for PostCodeAreaFetcher
@@ -48,37 +56,19 @@ func (p PostCodeAreaFetcher) String() string {
 
 // Base URL
 func (p *PostCodeAreaFetcher) BaseUrl() string {
-	return PostCodeAreaUrl;
-}
-
-// Parse JSON results
-func (p *PostCodeAreaFetcher) ParseResults(body []byte) (int, error) {
-	err := ParseJSON(body,&p.Results)
-	return len(p.Results), err
+	if p.Url != "" {
+		return p.Url
+	}
+	return PostCodeAreaUrl
 }
 
-// Create or save results at specified index
-func (p *PostCodeAreaFetcher) CreateOrSave(db *gorm.DB, index int) error {
-	if index >= len(p.Results) {
-		return errors.New("Invalid index: " + strconv.Itoa(index))
-	} 
-	r := p.Results[index]
-	poa := PostCodeArea{}
-	db.Where("ID = ?", r.Id).First(&poa)
-	area := &PostCodeArea{ID: r.Id, Label: FirstOrEmptyXmlValue(r.Labels)}
-
-	if poa.ID == "" {
-		err := db.Create(area).Error
-
-		if err != nil {
-			return err
-		}
-	} else {
-		err := db.Save(area).Error
-
-		if err != nil {
+// Parse streamed JSON results into PostCodeArea records, passing each to fn
+func (p *PostCodeAreaFetcher) ParseResults(r io.Reader, fn func(Persistable) error) error {
+	return DecodeJSONArray(r, func(dec *json.Decoder) error {
+		var result PostCodeAreaResponse
+		if err := dec.Decode(&result); err != nil {
 			return err
 		}
-	}
-	return nil
+		return fn(result.Model())
+	})
 }
@@ -1,9 +1,8 @@
 package dataloaders
 
 import (
-	"errors"
-	"github.com/jinzhu/gorm"
-	"strconv"
+	"encoding/json"
+	"io"
 	"strings"
 	"time"
 )
@@ -23,10 +22,24 @@ func (p PostCodeDistrictResponse) String() string {
 	return p.Id
 }
 
+// Converts the response into a database model
+func (r PostCodeDistrictResponse) Model() *PostCodeDistrict {
+	district := &PostCodeDistrict{ID: r.Id, Label: FirstOrEmptyXmlValue(r.Labels)}
+
+	c := len(r.Within)
+	for i := 0; i < c; i++ {
+		if strings.Count(r.Within[i].Id, "postcodearea") > 0 {
+			district.AreaID = &r.Within[i].Id
+		}
+	}
+
+	return district
+}
+
 // PostCode unit database model
 type PostCodeDistrict struct {
 	ID string `gorm:"primary_key"`
-	AreaID string `gorm:"index"`
+	AreaID *string `gorm:"index"`
 	Label string
 	CreatedAt time.Time
 	UpdatedAt time.Time
@@ -38,10 +51,14 @@ func (p PostCodeDistrict) String() string {
 	return p.ID
 }
 
+// Persist using a batch
+func (p *PostCodeDistrict) Persist(batch *Batch) error {
+	return batch.Write(p)
+}
+
 // PostCodeDistrict fetcher
 type PostCodeDistrictFetcher struct {
-	Results []PostCodeDistrictResponse
-	TotalResults int
+	Url string // fetched in place of PostCodeDistrictUrl, if set
 }
 
 // Stringer for PostCodeDistrictFetcher
@@ -51,44 +68,19 @@ func (p PostCodeDistrictFetcher) String() string {
 
 // Base URL
 func (p *PostCodeDistrictFetcher) BaseUrl() string {
-	return PostCodeDistrictUrl;
-}
-
-// Parse JSON results
-func (p *PostCodeDistrictFetcher) ParseResults(body []byte) (int, error) {
-	err := ParseJSON(body,&p.Results)
-	return len(p.Results), err
-}
-
-// Create or save results at specified index
-func (p *PostCodeDistrictFetcher) CreateOrSave(db *gorm.DB, index int) error {
-	if index >= len(p.Results) {
-		return errors.New("Invalid index: " + strconv.Itoa(index))
-	} 
-	r := p.Results[index]
-	poa := PostCodeDistrict{}
-	db.Where("ID = ?", r.Id).First(&poa)
-	district := &PostCodeDistrict{ID: r.Id, Label: FirstOrEmptyXmlValue(r.Labels)}
-
-	c := len(r.Within)
-	for i := 0; i < c; i++ {
-		if strings.Count(r.Within[i].Id, "postcodearea") > 0 {
-			district.AreaID = r.Within[i].Id
-		}
+	if p.Url != "" {
+		return p.Url
 	}
+	return PostCodeDistrictUrl
+}
 
-	if poa.ID == "" {
-		err := db.Create(district).Error
-
-		if err != nil {
-			return err
-		}
-	} else {
-		err := db.Save(district).Error
-
-		if err != nil {
+// Parse streamed JSON results into PostCodeDistrict records, passing each to fn
+func (p *PostCodeDistrictFetcher) ParseResults(r io.Reader, fn func(Persistable) error) error {
+	return DecodeJSONArray(r, func(dec *json.Decoder) error {
+		var result PostCodeDistrictResponse
+		if err := dec.Decode(&result); err != nil {
 			return err
 		}
-	}
-	return nil
+		return fn(result.Model())
+	})
 }
@@ -1,9 +1,8 @@
 package dataloaders
 
 import (
-	"errors"
-	"github.com/jinzhu/gorm"
-	"strconv"
+	"encoding/json"
+	"io"
 	"strings"
 	"time"
 )
@@ -23,10 +22,24 @@ func (p PostCodeSectorResponse) String() string {
 	return p.Id
 }
 
+// Converts the response into a database model
+func (r PostCodeSectorResponse) Model() *PostCodeSector {
+	sector := &PostCodeSector{ID: r.Id, Label: FirstOrEmptyXmlValue(r.Labels)}
+
+	c := len(r.Within)
+	for i := 0; i < c; i++ {
+		if strings.Count(r.Within[i].Id, "postcodedistrict") > 0 {
+			sector.DistrictID = &r.Within[i].Id
+		}
+	}
+
+	return sector
+}
+
 // PostCode unit database model
 type PostCodeSector struct {
 	ID string `gorm:"primary_key"`
-	DistrictID string `gorm:"index"`
+	DistrictID *string `gorm:"index"`
 	Label string
 	CreatedAt time.Time
 	UpdatedAt time.Time
@@ -38,10 +51,14 @@ func (p PostCodeSector) String() string {
 	return p.ID
 }
 
-// PostCodeArea fetcher
+// Persist using a batch
+func (p *PostCodeSector) Persist(batch *Batch) error {
+	return batch.Write(p)
+}
+
+// PostCodeSector fetcher
 type PostCodeSectorFetcher struct {
-	Results []PostCodeSectorResponse
-	TotalResults int
+	Url string // fetched in place of PostCodeSectorUrl, if set
 }
 
 // Stringer for PostCodeSectorFetcher
@@ -51,44 +68,19 @@ func (p PostCodeSectorFetcher) String() string {
 
 // Base URL
 func (p *PostCodeSectorFetcher) BaseUrl() string {
-	return PostCodeSectorUrl;
-}
-
-// Parse JSON results
-func (p *PostCodeSectorFetcher) ParseResults(body []byte) (int, error) {
-	err := ParseJSON(body,&p.Results)
-	return len(p.Results), err
-}
-
-// Create or save results at specified index
-func (p *PostCodeSectorFetcher) CreateOrSave(db *gorm.DB, index int) error {
-	if index >= len(p.Results) {
-		return errors.New("Invalid index: " + strconv.Itoa(index))
-	} 
-	r := p.Results[index]
-	poa := PostCodeSector{}
-	db.Where("ID = ?", r.Id).First(&poa)
-	sector := &PostCodeSector{ID: r.Id, Label: FirstOrEmptyXmlValue(r.Labels)}
-
-	c := len(r.Within)
-	for i := 0; i < c; i++ {
-		if strings.Count(r.Within[i].Id, "postcodedistrict") > 0 {
-			sector.DistrictID = r.Within[i].Id
-		}
+	if p.Url != "" {
+		return p.Url
 	}
+	return PostCodeSectorUrl
+}
 
-	if poa.ID == "" {
-		err := db.Create(sector).Error
-
-		if err != nil {
-			return err
-		}
-	} else {
-		err := db.Save(sector).Error
-
-		if err != nil {
+// Parse streamed JSON results into PostCodeSector records, passing each to fn
+func (p *PostCodeSectorFetcher) ParseResults(r io.Reader, fn func(Persistable) error) error {
+	return DecodeJSONArray(r, func(dec *json.Decoder) error {
+		var result PostCodeSectorResponse
+		if err := dec.Decode(&result); err != nil {
 			return err
 		}
-	}
-	return nil
+		return fn(result.Model())
+	})
 }
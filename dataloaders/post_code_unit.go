@@ -1,9 +1,8 @@
 package dataloaders
 
 import (
-	"errors"
-	"github.com/jinzhu/gorm"
-	"strconv"
+	"encoding/json"
+	"io"
 	"strings"
 	"time"
 )
@@ -37,12 +36,36 @@ func (p PostCodeUnitResponse) String() string {
 	return p.Id
 }
 
+// Converts the response into a database model
+func (r PostCodeUnitResponse) Model() *PostCodeUnit {
+	unit := &PostCodeUnit{ID: r.Id, Label: FirstOrEmptyXmlValue(r.Labels), Latitude: FirstOrEmptyXmlDataType(r.Latitude),
+		Longitude: FirstOrEmptyXmlDataType(r.Longitude), Northing: FirstOrEmptyXmlDataType(r.Northing),
+		Easting: FirstOrEmptyXmlDataType(r.Easting), Ward: FirstOrEmptyXmlId(r.Ward), 
+		District: FirstOrEmptyXmlId(r.District), Country: FirstOrEmptyXmlId(r.Country), 
+		County: FirstOrEmptyXmlId(r.County)}
+
+	c := len(r.Within)
+	for i := 0; i < c; i++ {
+		if strings.Count(r.Within[i].Id, "postcodearea") > 0 {
+			unit.AreaID = &r.Within[i].Id
+		}
+		if strings.Count(r.Within[i].Id, "postcodedistrict") > 0 {
+			unit.DistrictID = &r.Within[i].Id
+		}
+		if strings.Count(r.Within[i].Id, "postcodesector") > 0 {
+			unit.SectorID = &r.Within[i].Id
+		}
+	}
+
+	return unit
+}
+
 // PostCode unit database model
 type PostCodeUnit struct {
 	ID string `gorm:"primary_key"`
-	SectorID string `gorm:"index"`
-	DistrictID string `gorm:"index"`
-	AreaID string `gorm:"index"`
+	SectorID *string `gorm:"index"`
+	DistrictID *string `gorm:"index"`
+	AreaID *string `gorm:"index"`
 	Label string
 	CreatedAt time.Time
 	UpdatedAt time.Time
@@ -62,9 +85,14 @@ func (p PostCodeUnit) String() string {
 	return p.ID
 }
 
+// Persist using a batch
+func (p *PostCodeUnit) Persist(batch *Batch) error {
+	return batch.Write(p)
+}
+
 // PostCodeUnit fetcher
 type PostCodeUnitFetcher struct {
-	Results []PostCodeUnitResponse
+	Url string // fetched in place of PostCodeUnitUrl, if set
 }
 
 // Stringer for PostCodeUnitFetcher
@@ -74,55 +102,19 @@ func (p PostCodeUnitFetcher) String() string {
 
 // Base URL
 func (p *PostCodeUnitFetcher) BaseUrl() string {
-	return PostCodeUnitUrl;
-}
-
-// Parse JSON results
-func (p *PostCodeUnitFetcher) ParseResults(body []byte) (int, error) {
-	err := ParseJSON(body,&p.Results)
-	return len(p.Results), err
-}
-
-// Create or save results at specified index
-func (p *PostCodeUnitFetcher) CreateOrSave(db *gorm.DB, index int) error {
-	if index >= len(p.Results) {
-		return errors.New("Invalid index: " + strconv.Itoa(index))
-	} 
-	r := p.Results[index]
-	pou := PostCodeUnit{}
-	db.Where("ID = ?", r.Id).First(&pou)
-	unit := &PostCodeUnit{ID: r.Id, Label: FirstOrEmptyXmlValue(r.Labels), Latitude: FirstOrEmptyXmlDataType(r.Latitude),
-		Longitude: FirstOrEmptyXmlDataType(r.Longitude), Northing: FirstOrEmptyXmlDataType(r.Northing),
-		Easting: FirstOrEmptyXmlDataType(r.Easting), Ward: FirstOrEmptyXmlId(r.Ward), 
-		District: FirstOrEmptyXmlId(r.District), Country: FirstOrEmptyXmlId(r.Country), 
-		County: FirstOrEmptyXmlId(r.County)}
-
-	c := len(r.Within)
-	for i := 0; i < c; i++ {
-		if strings.Count(r.Within[i].Id, "postcodearea") > 0 {
-			unit.AreaID = r.Within[i].Id
-		}
-		if strings.Count(r.Within[i].Id, "postcodedistrict") > 0 {
-			unit.DistrictID = r.Within[i].Id
-		}
-		if strings.Count(r.Within[i].Id, "postcodesector") > 0 {
-			unit.SectorID = r.Within[i].Id
-		}
+	if p.Url != "" {
+		return p.Url
 	}
+	return PostCodeUnitUrl
+}
 
-	if pou.ID == "" {
-		err := db.Create(unit).Error
-
-		if err != nil {
-			return err
-		}
-	} else {
-		err := db.Save(unit).Error
-
-		if err != nil {
+// Parse streamed JSON results into PostCodeUnit records, passing each to fn
+func (p *PostCodeUnitFetcher) ParseResults(r io.Reader, fn func(Persistable) error) error {
+	return DecodeJSONArray(r, func(dec *json.Decoder) error {
+		var result PostCodeUnitResponse
+		if err := dec.Decode(&result); err != nil {
 			return err
 		}
-	}
-
-	return nil
-}
\ No newline at end of file
+		return fn(result.Model())
+	})
+}
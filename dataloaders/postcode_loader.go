@@ -1,40 +1,112 @@
 package dataloaders
 
 import (
+	"context"
 	"github.com/jinzhu/gorm"
 )
 
 // PostCodeLoader is a data loader for ONS Post Code JSON format.
 type PostCodeLoader struct {}
 
-// Loads post code data
-func (p PostCodeLoader) Load(db *gorm.DB) (err error) {
-	db.AutoMigrate(&PostCodeUnit{})
+func init() {
+	Register(Registration{Name: "postcode",
+		Description: "Post code areas, districts, sectors and units",
+		Sources: []string{PostCodeAreaUrl, PostCodeDistrictUrl, PostCodeSectorUrl, PostCodeUnitUrl},
+		Tables: []string{"post_code_areas", "post_code_districts", "post_code_sectors", "post_code_units", "load_errors"},
+		Loader: &PostCodeLoader{}})
+}
+
+// References between levels of the post code hierarchy
+var postCodeReferences = []ForeignKey{
+	{"post_code_districts", "area_id", "post_code_areas"},
+	{"post_code_sectors", "district_id", "post_code_districts"},
+	{"post_code_units", "area_id", "post_code_areas"},
+	{"post_code_units", "district_id", "post_code_districts"},
+	{"post_code_units", "sector_id", "post_code_sectors"},
+}
+
+// Levels of the post code hierarchy, each loaded before the levels within it
+var postCodeLevels = []struct {
+	source string
+	table string
+	url string
+	fetcher func(url string) Fetcher
+}{
+	{"postcode-area", "post_code_areas", PostCodeAreaUrl,
+		func(url string) Fetcher { return &PostCodeAreaFetcher{Url: url} }},
+	{"postcode-district", "post_code_districts", PostCodeDistrictUrl,
+		func(url string) Fetcher { return &PostCodeDistrictFetcher{Url: url} }},
+	{"postcode-sector", "post_code_sectors", PostCodeSectorUrl,
+		func(url string) Fetcher { return &PostCodeSectorFetcher{Url: url} }},
+	{"postcode-unit", "post_code_units", PostCodeUnitUrl,
+		func(url string) Fetcher { return &PostCodeUnitFetcher{Url: url} }},
+}
+
+// Adds foreign keys to the post code hierarchy
+func migratePostCodeForeignKeys(tx *gorm.DB) error {
+	return AddForeignKeys(tx, postCodeReferences)
+}
+
+// Loads post code data. Each level of the hierarchy is loaded before the
+// levels within it, and references to parents missing from their source are
+// dropped and recorded in load_errors. Once loaded, the load fails if any rows
+// still refer to missing parents, such as rows loaded before the foreign keys
+// existed; otherwise the foreign keys are validated.
+func (p PostCodeLoader) Load(ctx context.Context, db *gorm.DB) (err error) {
 	db.AutoMigrate(&PostCodeArea{})
-	db.AutoMigrate(&PostCodeSector{})
 	db.AutoMigrate(&PostCodeDistrict{})
+	db.AutoMigrate(&PostCodeSector{})
+	db.AutoMigrate(&PostCodeUnit{})
+	db.AutoMigrate(&LoadCheckpoint{})
+	db.AutoMigrate(&SourceVersion{})
+	db.AutoMigrate(&LoadError{})
+
+	fetchers := make([]Fetcher, len(postCodeLevels))
+
+	for i, level := range postCodeLevels {
+		location, err := SourceLocation(level.source, level.url)
 
-	ch := make(chan bool)
+		if err != nil {
+			return err
+		}
 
-	go FetchAll(ch, db, &PostCodeDistrictFetcher{})
+		fetchers[i] = level.fetcher(location)
+	}
 
-	go FetchAll(ch, db, &PostCodeSectorFetcher{})
+	err = Migrate(db, "postcode-foreign-keys", migratePostCodeForeignKeys)
 
-	go FetchAll(ch, db, &PostCodeAreaFetcher{})
+	if err != nil {
+		return err
+	}
 
-	go FetchAll(ch, db, &PostCodeUnitFetcher{})
+	for i, level := range postCodeLevels {
+		references, err := NewReferenceCheck(db, level.source, level.table, postCodeReferences)
 
-	count := 0
-	for {
-		
-		if f := <- ch; f {
-			count += 1
+		if err != nil {
+			return err
 		}
 
-		if count > 3 {
-			break
+		err = FetchAll(WithReferenceCheck(ctx, references), db, fetchers[i])
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
 		}
 	}
 
-	return nil
-}
\ No newline at end of file
+	orphans, err := CheckReferences(db, postCodeReferences)
+
+	if err != nil {
+		return err
+	}
+
+	err = ReportOrphans(RunStatsFrom(ctx), orphans)
+
+	if err != nil {
+		return err
+	}
+
+	return ValidateForeignKeys(db, postCodeReferences)
+}
@@ -0,0 +1,41 @@
+package dataloaders
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestPostCodeLoaderRejectsInvalidYear(t *testing.T) {
+	defer func(year string) {
+		Year = year
+	}(Year)
+	Year = "soon"
+
+	db, d := openFakeDB(t)
+	err := PostCodeLoader{}.Load(context.Background(), db)
+	if err == nil || !strings.Contains(err.Error(), "Invalid academic year") {
+		t.Errorf("error %v, want an invalid academic year", err)
+	}
+	if fetched := d.matching(`INSERT INTO "post_code_areas"`); len(fetched) > 0 {
+		t.Errorf("%d pages loaded", len(fetched))
+	}
+}
+
+func TestPostCodeFetcherBaseUrl(t *testing.T) {
+	tests := []struct {
+		fetcher Fetcher
+		url string
+	}{
+		{&PostCodeAreaFetcher{}, PostCodeAreaUrl},
+		{&PostCodeDistrictFetcher{}, PostCodeDistrictUrl},
+		{&PostCodeSectorFetcher{}, PostCodeSectorUrl},
+		{&PostCodeUnitFetcher{}, PostCodeUnitUrl},
+		{&PostCodeUnitFetcher{Url: "/data/units.json"}, "/data/units.json"},
+	}
+	for _, test := range tests {
+		if url := test.fetcher.BaseUrl(); url != test.url {
+			t.Errorf("%v BaseUrl() = %q, want %q", test.fetcher, url, test.url)
+		}
+	}
+}
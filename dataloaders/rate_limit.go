@@ -0,0 +1,54 @@
+package dataloaders
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Most requests per second made to any one host, zero for no limit
+var RequestsPerSecond = 0.0
+
+var (
+	hostLimitsMu sync.Mutex
+	hostLimits = make(map[string]*hostLimit)
+)
+
+// Next time a request may be made to a host
+type hostLimit struct {
+	mu sync.Mutex
+	next time.Time
+}
+
+// Blocks until a request to the URL's host is allowed by RequestsPerSecond
+// or ctx is cancelled
+func WaitForHost(ctx context.Context, rawurl string) error {
+	if RequestsPerSecond <= 0 {
+		return ctx.Err()
+	}
+	host := rawurl
+	if u, err := url.Parse(rawurl); err == nil {
+		host = u.Host
+	}
+
+	hostLimitsMu.Lock()
+	l, ok := hostLimits[host]
+	if !ok {
+		l = &hostLimit{}
+		hostLimits[host] = l
+	}
+	hostLimitsMu.Unlock()
+
+	interval := time.Duration(float64(time.Second) / RequestsPerSecond)
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(interval)
+	l.mu.Unlock()
+
+	return Sleep(ctx, wait)
+}
@@ -0,0 +1,73 @@
+package dataloaders
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"github.com/jinzhu/gorm"
+)
+
+// Interface for Data.gov.uk data loaders
+type DataLoader interface {
+	Load(ctx context.Context, db *gorm.DB) (error)
+}
+
+// Describes a data loader available by name
+type Registration struct {
+	Name string
+	Description string
+	Sources []string
+	Tables []string
+	Loader DataLoader
+}
+
+var (
+	registryMu sync.RWMutex
+	registry = make(map[string]Registration)
+)
+
+// Registers a data loader under its name. Packages outside dataloaders can
+// call this from an init function to add their own loaders. Panics if the
+// name is blank, the loader is nil or the name is already registered.
+func Register(r Registration) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if r.Name == "" {
+		panic("dataloaders: Register with blank name")
+	}
+	if r.Loader == nil {
+		panic("dataloaders: Register loader is nil for " + r.Name)
+	}
+	if _, dup := registry[r.Name]; dup {
+		panic("dataloaders: Register called twice for " + r.Name)
+	}
+	registry[r.Name] = r
+}
+
+// Looks up a registered data loader by name
+func Lookup(name string) (Registration, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	r, ok := registry[name]
+	if !ok {
+		return r, errors.New("Unknown data loader: " + name)
+	}
+	return r, nil
+}
+
+// Returns all registered data loaders sorted by name
+func Registered() []Registration {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	list := make([]Registration, 0, len(names))
+	for _, name := range names {
+		list = append(list, registry[name])
+	}
+	return list
+}
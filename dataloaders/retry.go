@@ -0,0 +1,114 @@
+package dataloaders
+
+import (
+	"io"
+	"context"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Attempts made at a transient operation before giving up
+var RetryAttempts = 5
+
+// Delay before the first retry, doubled after each further failure
+var RetryDelay = time.Second
+
+// Error for an HTTP response with an unexpected status
+type HttpError struct {
+	Url string
+	StatusCode int
+	Status string
+	RetryAfter time.Duration // from the Retry-After header, if any
+}
+
+// Returns the error for a response with an unexpected status
+func newHttpError(rawurl string, resp *http.Response) *HttpError {
+	e := &HttpError{Url: rawurl, StatusCode: resp.StatusCode, Status: resp.Status}
+	if after := resp.Header.Get("Retry-After"); after != "" {
+		if seconds, err := strconv.Atoi(after); err == nil {
+			e.RetryAfter = time.Duration(seconds) * time.Second
+		} else if t, err := http.ParseTime(after); err == nil {
+			e.RetryAfter = t.Sub(time.Now())
+		}
+	}
+	return e
+}
+
+func (e *HttpError) Error() string {
+	return e.Url + ": " + e.Status
+}
+
+// Server errors and rate limiting are worth retrying
+func (e *HttpError) Temporary() bool {
+	return e.StatusCode >= 500 || e.StatusCode == 429
+}
+
+// Reports whether an error is a transient network or HTTP failure: a server
+// error or rate limiting, a timeout, a connection reset or a response cut
+// short. Errors such as an unsupported scheme or an invalid certificate are
+// not worth retrying.
+func IsTransient(err error) bool {
+	if e, ok := err.(*url.Error); ok {
+		err = e.Err
+	}
+	switch e := err.(type) {
+	case *HttpError:
+		return e.Temporary()
+	case *net.OpError:
+		if e.Timeout() {
+			return true
+		}
+		if se, ok := e.Err.(*os.SyscallError); ok {
+			return se.Err == syscall.ECONNRESET
+		}
+		return e.Err == syscall.ECONNRESET
+	case net.Error:
+		return e.Timeout()
+	}
+	return err == io.EOF || err == io.ErrUnexpectedEOF
+}
+
+// Calls fn until it succeeds, fails with a non-transient error, ctx is
+// cancelled or RetryAttempts is reached, sleeping with exponential backoff
+// and jitter between attempts, or as long as a server asks with Retry-After
+// if that is longer
+func Retry(ctx context.Context, fn func() error) (err error) {
+	delay := RetryDelay
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || ctx.Err() != nil || !IsTransient(err) || attempt >= RetryAttempts {
+			return err
+		}
+		sleep := delay / 2 + time.Duration(rand.Int63n(int64(delay)))
+		if e, ok := err.(*HttpError); ok && e.RetryAfter > sleep {
+			sleep = e.RetryAfter
+		}
+		log.Println("Retrying in", sleep, "after:", err)
+		if serr := Sleep(ctx, sleep); serr != nil {
+			return serr
+		}
+		delay *= 2
+	}
+}
+
+// Sleeps for d, returning early with ctx's error if it is cancelled
+func Sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,214 @@
+package dataloaders
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+	"github.com/jinzhu/gorm"
+)
+
+// Load CSV sources even if columns their models expect are missing
+var AllowSchemaDrift = false
+
+// Header row of a source when it was last loaded, so new columns can be
+// reported
+type SourceHeader struct {
+	Source string `gorm:"primary_key"`
+	Columns string `gorm:"type:text"` // JSON array of column names
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Stringer for SourceHeader
+func (p SourceHeader) String() string {
+	return p.Source
+}
+
+// Returns the columns in the header, or nil if it is not recorded
+func (p SourceHeader) Header() []string {
+	var columns []string
+	if p.Columns != "" {
+		json.Unmarshal([]byte(p.Columns), &columns)
+	}
+	return columns
+}
+
+// Returns the header row of a source as it should be recorded
+func NewSourceHeader(source string, header []string) (*SourceHeader, error) {
+	b, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	return &SourceHeader{Source: source, Columns: string(b)}, nil
+}
+
+// Returns the header row recorded for a source, or nil if there is none
+func PreviousHeader(db *gorm.DB, source string) ([]string, error) {
+	previous := SourceHeader{}
+	err := db.Where("source = ?", source).First(&previous).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return previous.Header(), nil
+}
+
+// Differences between the columns a source is expected to have and its
+// header row
+type SchemaDrift struct {
+	Source string
+	Missing []string // expected but not in the header
+	New []string // in the header but not when the source was last loaded
+	Renamed map[string]string // missing column to the new column that probably replaced it
+}
+
+// Reports whether any expected columns are missing
+func (d *SchemaDrift) Failed() bool {
+	return len(d.Missing) > 0
+}
+
+// Reports whether there are any differences
+func (d *SchemaDrift) Changed() bool {
+	return len(d.Missing) > 0 || len(d.New) > 0
+}
+
+func (d *SchemaDrift) Error() string {
+	var b bytes.Buffer
+	b.WriteString("Schema drift in " + d.Source + " header:")
+	for _, column := range d.Missing {
+		if renamed, ok := d.Renamed[column]; ok {
+			b.WriteString("\n  renamed? " + column + " -> " + renamed)
+		} else {
+			b.WriteString("\n  - " + column)
+		}
+	}
+	for _, column := range d.New {
+		if !d.renamedTo(column) {
+			b.WriteString("\n  + " + column)
+		}
+	}
+	return b.String()
+}
+
+func (d *SchemaDrift) renamedTo(column string) bool {
+	for _, renamed := range d.Renamed {
+		if renamed == column {
+			return true
+		}
+	}
+	return false
+}
+
+// Compares the header row of a source to the columns expected by its model
+// and to the header when it was last loaded, if known. Missing columns are
+// matched to a new or unexpected column with a similar name, or one that
+// contains the other's name, as a likely rename.
+func CompareHeader(source string, expected []string, previous []string, header []string) *SchemaDrift {
+	d := &SchemaDrift{Source: source, Renamed: make(map[string]string)}
+	actual := stringSet(header)
+	wanted := stringSet(expected)
+	known := stringSet(previous)
+
+	for _, column := range expected {
+		if !actual[column] {
+			d.Missing = append(d.Missing, column)
+		}
+	}
+	if previous != nil {
+		for _, column := range header {
+			if !known[column] {
+				d.New = append(d.New, column)
+			}
+		}
+	}
+
+	for _, column := range d.Missing {
+		best, bestDistance := "", -1
+		for _, candidate := range header {
+			if wanted[candidate] || (previous != nil && known[candidate]) || d.renamedTo(candidate) || normaliseColumn(candidate) == "" {
+				continue
+			}
+			distance := columnDistance(column, candidate)
+			similar := distance <= len(column) / 4 + 1 ||
+				strings.Contains(normaliseColumn(candidate), normaliseColumn(column)) ||
+				strings.Contains(normaliseColumn(column), normaliseColumn(candidate))
+			if similar && (bestDistance < 0 || distance < bestDistance) {
+				best, bestDistance = candidate, distance
+			}
+		}
+		if best != "" {
+			d.Renamed[column] = best
+		}
+	}
+	return d
+}
+
+// Checks the header row of a source before it is loaded. Returns a
+// *SchemaDrift error if expected columns are missing, unless
+// AllowSchemaDrift is set, and logs any other differences.
+func CheckHeader(db *gorm.DB, source string, expected []string, header []string) error {
+	previous, err := PreviousHeader(db, source)
+	if err != nil {
+		return err
+	}
+	drift := CompareHeader(source, expected, previous, header)
+	if drift.Failed() && !AllowSchemaDrift {
+		return drift
+	}
+	if drift.Changed() {
+		log.Println(drift.Error())
+	}
+	return nil
+}
+
+func stringSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+// Edit distance between column names, ignoring case, spaces and punctuation
+func columnDistance(a string, b string) int {
+	x, y := []rune(normaliseColumn(a)), []rune(normaliseColumn(b))
+	row := make([]int, len(y) + 1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(x); i++ {
+		diagonal := row[0]
+		row[0] = i
+		for j := 1; j <= len(y); j++ {
+			above := row[j]
+			cost := 1
+			if x[i - 1] == y[j - 1] {
+				cost = 0
+			}
+			row[j] = minInt(minInt(row[j] + 1, row[j - 1] + 1), diagonal + cost)
+			diagonal = above
+		}
+	}
+	return row[len(y)]
+}
+
+func normaliseColumn(column string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, column)
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
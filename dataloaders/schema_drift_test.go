@@ -0,0 +1,60 @@
+package dataloaders
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompareHeader(t *testing.T) {
+	tests := []struct {
+		name string
+		expected []string
+		previous []string
+		header []string
+		missing []string
+		new []string
+		renamed map[string]string
+	}{
+		{"unchanged", []string{"URN", "TOWN"}, []string{"URN", "TOWN"}, []string{"URN", "TOWN"},
+			nil, nil, map[string]string{}},
+		{"not loaded before", []string{"URN", "TOWN"}, nil, []string{"URN", "TOWN", "EXTRA"},
+			nil, nil, map[string]string{}},
+		{"new column", []string{"URN"}, []string{"URN"}, []string{"URN", "EXTRA"},
+			nil, []string{"EXTRA"}, map[string]string{}},
+		{"missing column", []string{"URN", "TOWN"}, []string{"URN", "TOWN"}, []string{"URN"},
+			[]string{"TOWN"}, nil, map[string]string{}},
+		{"renamed with a typo", []string{"URN", "PTKS1GROUP_L"}, []string{"URN", "PTKS1GROUP_L"}, []string{"URN", "PTKS1GRP_L"},
+			[]string{"PTKS1GROUP_L"}, []string{"PTKS1GRP_L"}, map[string]string{"PTKS1GROUP_L": "PTKS1GRP_L"}},
+		{"renamed with a suffix", []string{"URN", "TOTPUPS"}, []string{"URN", "TOTPUPS"}, []string{"URN", "TOTPUPS_2016"},
+			[]string{"TOTPUPS"}, []string{"TOTPUPS_2016"}, map[string]string{"TOTPUPS": "TOTPUPS_2016"}},
+		{"renamed case and punctuation", []string{"Town", "URN"}, nil, []string{"town.", "URN"},
+			[]string{"Town"}, nil, map[string]string{"Town": "town."}},
+		{"closest of several", []string{"PERCTOT"}, nil, []string{"PERCTOTAL", "PERCTOT1"},
+			[]string{"PERCTOT"}, nil, map[string]string{"PERCTOT": "PERCTOT1"}},
+		{"each new column replaces one", []string{"TOWN", "TOWNS"}, nil, []string{"TOWN_"},
+			[]string{"TOWN", "TOWNS"}, nil, map[string]string{"TOWN": "TOWN_"}},
+		{"known column not a rename", []string{"URN", "TOWN"}, []string{"URN", "TOWN", "TOWNS"}, []string{"URN", "TOWNS"},
+			[]string{"TOWN"}, nil, map[string]string{}},
+		{"expected column not a rename", []string{"TOWN", "TOWNS"}, nil, []string{"TOWNS"},
+			[]string{"TOWN"}, nil, map[string]string{}},
+		{"blank column not a rename", []string{"URN", "TOWN"}, nil, []string{"URN", ""},
+			[]string{"TOWN"}, nil, map[string]string{}},
+		{"unrelated column not a rename", []string{"URN", "TOWN"}, nil, []string{"URN", "POSTCODE"},
+			[]string{"TOWN"}, nil, map[string]string{}},
+	}
+	for _, test := range tests {
+		d := CompareHeader("test", test.expected, test.previous, test.header)
+		if !reflect.DeepEqual(d.Missing, test.missing) {
+			t.Errorf("%s: missing %v, want %v", test.name, d.Missing, test.missing)
+		}
+		if !reflect.DeepEqual(d.New, test.new) {
+			t.Errorf("%s: new %v, want %v", test.name, d.New, test.new)
+		}
+		if !reflect.DeepEqual(d.Renamed, test.renamed) {
+			t.Errorf("%s: renamed %v, want %v", test.name, d.Renamed, test.renamed)
+		}
+		if d.Failed() != (len(test.missing) > 0) {
+			t.Errorf("%s: failed %v", test.name, d.Failed())
+		}
+	}
+}
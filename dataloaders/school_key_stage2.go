@@ -0,0 +1,152 @@
+package dataloaders
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+	"github.com/jinzhu/gorm"
+)
+
+// Key Stage 2 measures, published for schools, local authorities and England
+type KeyStage2Measures struct {
+	PupilsAge11 *int `csv:"TPUPYEAR"`
+	PublishedEligiblePupilNumber *int `csv:"TELIG"`
+	EligibleBoys *int `csv:"BELIG"`
+	EligibleGirls *int `csv:"GELIG"`
+	PercentageEligibleBoys *float64 `csv:"PBELIG"` // at time of tests
+	PercentageEligibleGirls *float64 `csv:"PGELIG"` // at time of tests
+	KeyStage1Average *float64 `csv:"TKS1APS"`
+	PupilsLowKeyStage1 *int `csv:"TKS1EXP_L"`
+	PercentageLowKeyStage1 *float64 `csv:"PKS1EXP_L"`
+	PupilsMediumKeyStage1 *int `csv:"TKS1EXP_M"`
+	PercentageMediumKeyStage1 *float64 `csv:"PKS1EXP_M"`
+	PupilsHighKeyStage1 *int `csv:"TKS1EXP_H"`
+	PercentageHighKeyStage1 *float64 `csv:"PKS1EXP_H"`
+	DisadvantagedPupils *int `csv:"TFSMCLA1A"`
+	PercentageDisadvantaged *float64 `csv:"PTFSM6CLA1A"`
+	NotDisadvantagedPupils *int `csv:"TNOTFSM6CLA1A"`
+	PercentageNotDisadvantaged *float64 `csv:"PTNOTFSM6CLA1A"`
+	EnglishSecondLanguage *int `csv:"TEALGRP2"`
+	PercentageEnglishSecondLanguage *float64 `csv:"PTEALGRP2"`
+	NonMobilePupils *int `csv:"TMOBN"`
+	PercentageNonMobile *float64 `csv:"PTMOBN"`
+	SpecialNeeds *int `csv:"SENELS"`
+	PercentageSpecialNeeds *float64 `csv:"PSENELS"`
+	PercentageMathsProgress2Levels *float64 `csv:"PT2MATH"`
+	PercentageInMathsProgressMeasured *float64 `csv:"COVMATH"`
+	PercentageReadingProgress2Levels *float64 `csv:"PT2READ"`
+	PercentageInReadingProgressMeasured *float64 `csv:"COVREAD"`
+	PercentageWritingProgress2Levels *float64 `csv:"PT2WRITTA"`
+	PercentageInWritingProgressMeasured *float64 `csv:"COVWRITTA"`
+	PercentageLevel4Minimum *float64 `csv:"PTREADWRITTAMATX"`
+	PercentageLevel48Minimum *float64 `csv:"PTREADWRITTAMAT4B"`
+	PercentageLevel5Minimum *float64 `csv:"PTREADWRITTAMATAX"`
+	PercentageLevel3Maximum *float64 `csv:"PTREADWRITTAMATBX"`
+	AveragePointScore *float64 `csv:"TAPS"`
+	AverageLevel *int `csv:"AVGLEVEL"`
+	AverageValueAdded *float64 `csv:"OVAMEAS"`
+	PercentageInValueAddedMeasure *float64 `csv:"VACOV"`
+	OverallConfidenceLower95Limit *int `csv:"OLCONF"`
+	OverallConfidenceUpper95Limit *int `csv:"OUCONF"`
+	MissingValues ValueStatuses `gorm:"type:jsonb"` // why nullable values are absent
+}
+
+// Key Stage 2 performance for a school in an academic year
+type SchoolKeyStage2 struct {
+	ID int `gorm:"primary_key"`
+	SchoolID int `gorm:"unique_index:idx_school_key_stage_2_school_year" csv:"URN"`
+	AcademicYear DatasetYear `gorm:"unique_index:idx_school_key_stage_2_school_year;size:7"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt *time.Time
+	LocalAuthorityID int `gorm:"index" csv:"LEA"`
+	EstablishmentNumber int `gorm:"index" csv:"ESTAB"`
+	KeyStage2Measures
+}
+
+// Key Stage 2 performance across a local authority's schools in an academic
+// year
+type LocalAuthorityKeyStage2 struct {
+	LocalAuthorityID int `gorm:"primary_key" csv:"LEA"`
+	AcademicYear DatasetYear `gorm:"primary_key;size:7"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	KeyStage2Measures
+}
+
+// Key Stage 2 performance across England in an academic year. The record
+// type distinguishes averages of all schools from those of maintained schools.
+type NationalKeyStage2 struct {
+	RecordType string `gorm:"primary_key" csv:"RECTYPE"`
+	AcademicYear DatasetYear `gorm:"primary_key;size:7"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	KeyStage2Measures
+}
+
+// RECTYPE of Key Stage 2 rows
+const (
+	keyStage2LocalAuthority = "4"
+	keyStage2National = "5"
+	keyStage2NationalMaintained = "7"
+)
+
+// Chooses the table a Key Stage 2 row belongs in by its RECTYPE, or if there
+// is none by whether it has a URN and local authority
+func keyStage2Model(r CSVRow) interface{} {
+	switch strings.TrimSpace(r.Get("RECTYPE")) {
+	case keyStage2LocalAuthority:
+		return &LocalAuthorityKeyStage2{}
+	case keyStage2National, keyStage2NationalMaintained:
+		return &NationalKeyStage2{}
+	case "":
+		if strings.TrimSpace(r.Get("URN")) == "" {
+			if strings.TrimSpace(r.Get("LEA")) == "" {
+				return &NationalKeyStage2{}
+			}
+			return &LocalAuthorityKeyStage2{}
+		}
+	}
+	return &SchoolKeyStage2{}
+}
+
+// Loads Key Stage 2 performance data, putting local authority and national
+// rows in their own tables. School rows for URNs not in schools are rejected.
+func (p SchoolLoader) LoadKeyStage2(ctx context.Context, db *gorm.DB) (err error) {
+	ids := []int{}
+
+	if err := db.Model(&School{}).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+
+	schools := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		schools[id] = true
+	}
+
+	return LoadCSVWith(ctx, db, "ks2", EnglandKS2Url, &SchoolKeyStage2{}, CSVOptions{
+		Route: keyStage2Model,
+		Models: []interface{}{&LocalAuthorityKeyStage2{}, &NationalKeyStage2{}},
+		Check: func(row interface{}) error {
+			if s, ok := row.(*SchoolKeyStage2); ok && !schools[s.SchoolID] {
+				return errors.New("no school with this URN")
+			}
+			return nil
+		}})
+}
+
+// Gives Key Stage 2 performance records created when they were keyed by URN a
+// surrogate key, with the URN moved to school_id referencing schools. Existing
+// rows for unknown schools are kept, so the foreign key is not validated
+// against them.
+func migrateKeyStage2Key(tx *gorm.DB) error {
+	return execAll(tx,
+		"UPDATE school_key_stage_2s SET school_id = id WHERE school_id IS NULL",
+		"ALTER TABLE school_key_stage_2s ALTER COLUMN school_id SET NOT NULL",
+		"ALTER TABLE school_key_stage_2s DROP CONSTRAINT IF EXISTS school_key_stage_2s_pkey",
+		"ALTER TABLE school_key_stage_2s ADD PRIMARY KEY (id)",
+		"SELECT setval(pg_get_serial_sequence('school_key_stage_2s', 'id'), (SELECT COALESCE(MAX(id), 0) + 1 FROM school_key_stage_2s), false)",
+		"ALTER TABLE school_key_stage_2s ADD CONSTRAINT school_key_stage_2s_school_id_fkey " +
+			"FOREIGN KEY (school_id) REFERENCES schools (id) NOT VALID")
+}
@@ -0,0 +1,70 @@
+package dataloaders
+
+import (
+	"context"
+	"time"
+	"github.com/jinzhu/gorm"
+)
+
+// Key Stage 4 (GCSE) performance for a school
+type SchoolKeyStage4 struct {
+	ID int `gorm:"primary_key" csv:"URN"`
+	AcademicYear DatasetYear `gorm:"primary_key;size:7"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt *time.Time
+	LocalAuthorityID int `gorm:"index" csv:"LEA"`
+	EstablishmentNumber int `gorm:"index" csv:"ESTAB"`
+	PupilsEndKeyStage4 *int `csv:"TPUP"`
+	PupilsLowKeyStage2 *int `csv:"TPRIORLO"`
+	PupilsMediumKeyStage2 *int `csv:"TPRIORAV"`
+	PupilsHighKeyStage2 *int `csv:"TPRIORHI"`
+	DisadvantagedPupils *int `csv:"TFSM6CLA1A"`
+	PercentageDisadvantaged *float64 `csv:"PTFSM6CLA1A"`
+	NotDisadvantagedPupils *int `csv:"TNOTFSM6CLA1A"`
+	PercentageNotDisadvantaged *float64 `csv:"PTNOTFSM6CLA1A"`
+	EnglishSecondLanguage *int `csv:"TEALGRP2"`
+	PercentageEnglishSecondLanguage *float64 `csv:"PTEALGRP2"`
+	PercentageFiveGCSEs *float64 `csv:"PTAC5_PTQ_EE"` // 5+ A*-C
+	PercentageFiveGCSEsEnglishMaths *float64 `csv:"PTAC5EM_PTQ_EE"` // 5+ A*-C including English and maths
+	PercentageEnglishMaths *float64 `csv:"PTL2BASICS_PTQ_EE"` // A*-C in English and maths
+	PercentageEnteredEBacc *float64 `csv:"PTEBACC_E_PTQ_EE"`
+	PercentageAchievedEBacc *float64 `csv:"PTEBACC_PTQ_EE"`
+	AverageAttainment8 *float64 `csv:"ATT8SCR"`
+	AverageProgress8 *float64 `csv:"P8MEA"`
+	Progress8ConfidenceLower95Limit *float64 `csv:"P8CILOW"`
+	Progress8ConfidenceUpper95Limit *float64 `csv:"P8CIUPP"`
+	PercentageFiveGCSEsEnglishMathsDisadvantaged *float64 `csv:"PTFSM6CLA1AAC5EM_PTQ_EE"`
+	PercentageFiveGCSEsEnglishMathsNotDisadvantaged *float64 `csv:"PTNOTFSM6CLA1AAC5EM_PTQ_EE"`
+	AverageAttainment8Disadvantaged *float64 `csv:"ATT8SCR_FSM6CLA1A"`
+	AverageAttainment8NotDisadvantaged *float64 `csv:"ATT8SCR_NFSM6CLA1A"`
+	AverageProgress8Disadvantaged *float64 `csv:"P8MEA_FSM6CLA1A"`
+	AverageProgress8NotDisadvantaged *float64 `csv:"P8MEA_NFSM6CLA1A"`
+	GapFiveGCSEsEnglishMaths *float64 // not disadvantaged minus disadvantaged
+	GapAttainment8 *float64 // not disadvantaged minus disadvantaged
+	GapProgress8 *float64 // not disadvantaged minus disadvantaged
+	MissingValues ValueStatuses `gorm:"type:jsonb"` // why nullable values are absent
+}
+
+// Works out the gaps between disadvantaged pupils and the rest. A gap is left
+// NULL unless both of its values were published.
+func (s *SchoolKeyStage4) AfterCSVMap() []interface{} {
+	s.GapFiveGCSEsEnglishMaths = floatGap(s.PercentageFiveGCSEsEnglishMathsNotDisadvantaged, s.PercentageFiveGCSEsEnglishMathsDisadvantaged)
+	s.GapAttainment8 = floatGap(s.AverageAttainment8NotDisadvantaged, s.AverageAttainment8Disadvantaged)
+	s.GapProgress8 = floatGap(s.AverageProgress8NotDisadvantaged, s.AverageProgress8Disadvantaged)
+	return nil
+}
+
+// Returns a minus b, or nil if either is missing
+func floatGap(a *float64, b *float64) *float64 {
+	if a == nil || b == nil {
+		return nil
+	}
+	gap := *a - *b
+	return &gap
+}
+
+// Loads Key Stage 4 (GCSE) performance data
+func (p SchoolLoader) LoadKeyStage4(ctx context.Context, db *gorm.DB) (err error) {
+	return LoadCSV(ctx, db, "ks4", EnglandKS4Url, &SchoolKeyStage4{})
+}
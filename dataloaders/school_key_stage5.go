@@ -0,0 +1,47 @@
+package dataloaders
+
+import (
+	"context"
+	"time"
+	"github.com/jinzhu/gorm"
+)
+
+// Key Stage 5 (16-18) performance for a school
+type SchoolKeyStage5 struct {
+	ID int `gorm:"primary_key" csv:"URN"`
+	AcademicYear DatasetYear `gorm:"primary_key;size:7"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt *time.Time
+	LocalAuthorityID int `gorm:"index" csv:"LEA"`
+	EstablishmentNumber int `gorm:"index" csv:"ESTAB"`
+	Students1618 *int `csv:"TPUP1618"`
+	StudentsALevel *int `csv:"TALLPUP_ALEV_1618"`
+	AveragePointScoreALevel *float64 `csv:"TALLPPE_ALEV_1618"` // per entry
+	AverageGradeALevel string `csv:"TALLPPEGRD_ALEV_1618"`
+	PercentageAABFacilitating *float64 `csv:"PTAABFAC_ALEV_1618"` // AAB or better, 2+ facilitating subjects
+	StudentsAcademic *int `csv:"TALLPUP_ACAD_1618"`
+	AveragePointScoreAcademic *float64 `csv:"TALLPPE_ACAD_1618"` // per entry
+	StudentsAppliedGeneral *int `csv:"TALLPUP_AGEN_1618"`
+	AveragePointScoreAppliedGeneral *float64 `csv:"TALLPPE_AGEN_1618"` // per entry
+	StudentsTechLevel *int `csv:"TALLPUP_TECH_1618"`
+	AveragePointScoreTechLevel *float64 `csv:"TALLPPE_TECH_1618"` // per entry
+	ValueAddedALevel *float64 `csv:"VA_INS_ALEV"`
+	ValueAddedAcademic *float64 `csv:"VA_INS_ACAD"`
+	ValueAddedAppliedGeneral *float64 `csv:"VA_INS_AGEN"`
+	ValueAddedTechLevel *float64 `csv:"VA_INS_TECH"`
+	PercentageRetainedAcademic *float64 `csv:"PTRETAINED_ACAD"` // retained and assessed
+	PercentageRetainedAppliedGeneral *float64 `csv:"PTRETAINED_AGEN"` // retained and assessed
+	PercentageRetainedTechLevel *float64 `csv:"PTRETAINED_TECH"` // retained and assessed
+	PercentageDestinationEducationEmployment *float64 `csv:"PTDEST_EDUEMP"` // sustained education or employment
+	PercentageDestinationHigherEducation *float64 `csv:"PTDEST_HE"`
+	PercentageDestinationFurtherEducation *float64 `csv:"PTDEST_FE"`
+	PercentageDestinationApprenticeship *float64 `csv:"PTDEST_APP"`
+	PercentageDestinationEmployment *float64 `csv:"PTDEST_EMP"`
+	MissingValues ValueStatuses `gorm:"type:jsonb"` // why nullable values are absent
+}
+
+// Loads Key Stage 5 (16-18) performance data
+func (p SchoolLoader) LoadKeyStage5(ctx context.Context, db *gorm.DB) (err error) {
+	return LoadCSV(ctx, db, "ks5", EnglandKS5Url, &SchoolKeyStage5{})
+}
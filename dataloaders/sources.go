@@ -0,0 +1,254 @@
+package dataloaders
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"github.com/jinzhu/gorm"
+)
+
+// Where to load each source from by name, e.g. "edubase" or "postcode-unit",
+// overriding its default URL: a URL, file:// URL or file path, which may be a
+// .gz or .zip archive with the member after a #.
+var SourceLocations = make(map[string]string)
+
+// Returns where to load a named source from, its location or the template
+// for Year if either is configured, otherwise defaultLocation
+func SourceLocation(name string, defaultLocation string) (string, error) {
+	env := strings.ToUpper(strings.Replace(name, "-", "_", -1))
+	location := SourceLocations[name]
+	if location == "" {
+		location = os.Getenv("SOURCE_" + env)
+	}
+	if location == "" {
+		location = configSources[name]
+	}
+	if location != "" {
+		if YearlySources[name] && Year == "" {
+			return "", errors.New("Academic year of " + name + " from " + location +
+				" is unknown, give it with --year, DATASET_YEAR or the config file")
+		}
+		return location, nil
+	}
+	if Year == "" {
+		return defaultLocation, nil
+	}
+
+	start, err := ParseAcademicYear(Year)
+	if err != nil {
+		return "", err
+	}
+	template := SourceTemplates[name]
+	if template == "" {
+		template = os.Getenv("SOURCE_TEMPLATE_" + env)
+	}
+	if template == "" {
+		template = configTemplates[name]
+	}
+	if template != "" {
+		return expandTemplate(template, start), nil
+	}
+	if YearlySources[name] {
+		return "", errors.New("No URL template for " + name + " to load " + AcademicYear(start) +
+			", give one with --source-template or SOURCE_TEMPLATE_" + env)
+	}
+	return defaultLocation, nil
+}
+
+// Reports whether a location is fetched over HTTP
+func IsRemoteSource(location string) bool {
+	lower := strings.ToLower(location)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// Reports whether a location is a .zip or .gz archive
+func IsArchiveSource(location string) bool {
+	ext := archiveExt(splitMember(location))
+	return ext == ".zip" || ext == ".gz"
+}
+
+// Opens a source for streaming, or returns a nil body if it is unchanged since
+// the version recorded in db. The caller must close the body and save the version.
+func OpenSource(ctx context.Context, db *gorm.DB, location string, revision string) (io.ReadCloser, *SourceVersion, error) {
+	resource, member := splitMember(location), ""
+	if resource != location {
+		member = location[len(resource) + 1:]
+	}
+
+	var body io.ReadCloser
+	var version *SourceVersion
+	var err error
+	if IsRemoteSource(resource) {
+		body, version, err = openUrlVersion(ctx, db, resource, location, revision)
+	} else {
+		body, version, err = openFileIfModified(db, resource, location, revision)
+	}
+	if err != nil || body == nil {
+		return nil, nil, err
+	}
+
+	switch archiveExt(resource) {
+	case ".gz":
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			body.Close()
+			return nil, nil, err
+		}
+		return &sourceReader{Reader: gz, closers: []io.Closer{gz, body}}, version, nil
+	case ".zip":
+		r, err := openZipMember(body, member)
+		if err != nil {
+			return nil, nil, err
+		}
+		return r, version, nil
+	}
+	return body, version, nil
+}
+
+// Reads a source, closing everything it was opened with
+type sourceReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (s *sourceReader) Close() error {
+	var err error
+	for _, c := range s.closers {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Returns a location without any archive member after #
+func splitMember(location string) string {
+	i := strings.LastIndex(location, "#")
+	if i < 0 || archiveExt(location[:i]) != ".zip" {
+		return location
+	}
+	return location[:i]
+}
+
+// Returns the lower case extension of the file a location names
+func archiveExt(location string) string {
+	p := location
+	if u, err := url.Parse(location); err == nil && u.Scheme != "" && len(u.Scheme) > 1 {
+		p = u.Path
+	}
+	return strings.ToLower(path.Ext(p))
+}
+
+// Opens a file:// URL or file path unless it is unchanged since the version
+// recorded under key at the same revision
+func openFileIfModified(db *gorm.DB, location string, key string, revision string) (io.ReadCloser, *SourceVersion, error) {
+	filename := location
+	if strings.HasPrefix(strings.ToLower(location), "file://") {
+		u, err := url.Parse(location)
+		if err != nil {
+			return nil, nil, err
+		}
+		filename = u.Path
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	version := &SourceVersion{Url: key,
+		ETag: strconv.FormatInt(info.Size(), 10) + "-" + strconv.FormatInt(info.ModTime().UnixNano(), 10),
+		LastModified: info.ModTime().UTC().Format("Mon, 02 Jan 2006 15:04:05 GMT"), Revision: revision}
+	if previousVersion(db, key, revision).ETag == version.ETag {
+		file.Close()
+		return nil, nil, nil
+	}
+	return file, version, nil
+}
+
+// Opens a member of a zip archive. Archives fetched over HTTP are copied to a
+// temporary file first, as zip members are found from the end of the file.
+func openZipMember(body io.ReadCloser, member string) (io.ReadCloser, error) {
+	file, ok := body.(*os.File)
+	temporary := ""
+	if !ok {
+		defer body.Close()
+		tmp, err := ioutil.TempFile("", "datagovuk-loader-")
+		if err != nil {
+			return nil, err
+		}
+		temporary = tmp.Name()
+		if _, err := io.Copy(tmp, body); err != nil {
+			tmp.Close()
+			os.Remove(temporary)
+			return nil, err
+		}
+		file = tmp
+	}
+	closeFile := func() {
+		file.Close()
+		if temporary != "" {
+			os.Remove(temporary)
+		}
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		closeFile()
+		return nil, err
+	}
+	archive, err := zip.NewReader(file, info.Size())
+	if err != nil {
+		closeFile()
+		return nil, err
+	}
+
+	var files []*zip.File
+	names := make([]string, 0, len(archive.File))
+	for _, f := range archive.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		names = append(names, f.Name)
+		if member == "" || f.Name == member || path.Base(f.Name) == member {
+			files = append(files, f)
+		}
+	}
+	if len(files) != 1 {
+		closeFile()
+		if member == "" && len(files) > 1 {
+			return nil, errors.New("Archive has several files, choose one with #member: " + strings.Join(names, ", "))
+		}
+		return nil, errors.New("No single " + member + " in archive, which has: " + strings.Join(names, ", "))
+	}
+	found := files[0]
+
+	r, err := found.Open()
+	if err != nil {
+		closeFile()
+		return nil, err
+	}
+	return &sourceReader{Reader: r, closers: []io.Closer{r, closerFunc(func() error {
+		closeFile()
+		return nil
+	})}}, nil
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
@@ -0,0 +1,62 @@
+package dataloaders
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSourceLocation(t *testing.T) {
+	defer func(year string) {
+		Year = year
+		delete(SourceLocations, "test-source")
+		delete(SourceTemplates, "test-source")
+		delete(configSources, "test-source")
+		delete(configTemplates, "test-source")
+		delete(YearlySources, "test-source")
+		os.Unsetenv("SOURCE_TEST_SOURCE")
+		os.Unsetenv("SOURCE_TEMPLATE_TEST_SOURCE")
+	}(Year)
+
+	tests := []struct {
+		name string
+		year string
+		yearly bool
+		flag, env, config string // locations
+		flagTemplate, envTemplate, configTemplate string
+		location string
+		err bool
+	}{
+		{"default", "", false, "", "", "", "", "", "", "default", false},
+		{"flag", "", false, "flag", "env", "config", "", "", "", "flag", false},
+		{"env", "", false, "", "env", "config", "", "", "", "env", false},
+		{"config", "", false, "", "", "config", "", "", "", "config", false},
+		{"templates without year", "", false, "", "", "", "f{year}", "e{year}", "c{year}", "default", false},
+		{"flag template", "2015-16", false, "", "", "", "f{year}", "e{year}", "c{year}", "f2015-16", false},
+		{"env template", "2015-16", false, "", "", "", "", "e{year}", "c{year}", "e2015-16", false},
+		{"config template", "2015-16", false, "", "", "", "", "", "c{year}", "c2015-16", false},
+		{"location over template", "2015-16", false, "", "", "config", "f{year}", "", "", "config", false},
+		{"not yearly without template", "2015-16", false, "", "", "", "", "", "", "default", false},
+		{"yearly without template", "2015-16", true, "", "", "", "", "", "", "", true},
+		{"yearly location without year", "", true, "", "env", "", "", "", "", "", true},
+		{"yearly location with year", "2015-16", true, "", "env", "", "", "", "", "env", false},
+		{"invalid year", "soon", false, "", "", "", "", "", "", "", true},
+	}
+	for _, test := range tests {
+		Year = test.year
+		YearlySources["test-source"] = test.yearly
+		SourceLocations["test-source"] = test.flag
+		os.Setenv("SOURCE_TEST_SOURCE", test.env)
+		configSources["test-source"] = test.config
+		SourceTemplates["test-source"] = test.flagTemplate
+		os.Setenv("SOURCE_TEMPLATE_TEST_SOURCE", test.envTemplate)
+		configTemplates["test-source"] = test.configTemplate
+
+		location, err := SourceLocation("test-source", "default")
+		if (err != nil) != test.err {
+			t.Errorf("%s: error %v", test.name, err)
+		}
+		if location != test.location {
+			t.Errorf("%s: location %q, want %q", test.name, location, test.location)
+		}
+	}
+}
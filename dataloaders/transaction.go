@@ -0,0 +1,81 @@
+package dataloaders
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+// Number of rows written per transaction by the CSV loaders and when loading
+// post code files. Zero writes each file in a single transaction.
+var BatchSize = 0
+
+// Groups writes into transactions that are committed every size rows
+type Batch struct {
+	Tx *gorm.DB
+	db *gorm.DB
+	writer *BulkWriter
+	size int
+	rows int
+	Stats *RunStats // receives the row counts of each commit, if set
+	BeforeCommit func() error // called before each commit, if set, rolling back instead if it fails
+	OnCommit func() // called after each commit, if set
+}
+
+// Begins a new batch of writes
+func NewBatch(db *gorm.DB, size int) (*Batch, error) {
+	b := &Batch{db: db, writer: NewBulkWriter(BulkRows), size: size}
+	return b, b.begin()
+}
+
+func (b *Batch) begin() error {
+	b.Tx = b.db.Begin()
+	b.rows = 0
+	return b.Tx.Error
+}
+
+// Buffers a model to be upserted in bulk within the current transaction
+func (b *Batch) Write(model interface{}) error {
+	return b.writer.Write(b.Tx, model)
+}
+
+// Records a written row, committing and starting a new transaction once the
+// batch is full
+func (b *Batch) Next() error {
+	b.rows += 1
+	if b.size < 1 || b.rows < b.size {
+		return nil
+	}
+	if err := b.Commit(); err != nil {
+		return err
+	}
+	return b.begin()
+}
+
+// Writes buffered models and commits any outstanding writes, rolling back
+// if they fail
+func (b *Batch) Commit() error {
+	if b.BeforeCommit != nil {
+		if err := b.BeforeCommit(); err != nil {
+			b.Rollback()
+			return err
+		}
+	}
+	if err := b.writer.Flush(b.Tx); err != nil {
+		b.Rollback()
+		return err
+	}
+	if err := b.Tx.Commit().Error; err != nil {
+		b.writer.Reset()
+		return err
+	}
+	b.Stats.Add(b.writer.TakeCounts())
+	if b.OnCommit != nil {
+		b.OnCommit()
+	}
+	return nil
+}
+
+// Discards any outstanding writes
+func (b *Batch) Rollback() {
+	b.writer.Reset()
+	b.Tx.Rollback()
+}
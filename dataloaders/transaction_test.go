@@ -0,0 +1,50 @@
+package dataloaders
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBatchCommitRollsBackOnFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		failing string
+		before error // returned by BeforeCommit
+		last string // last statement run
+	}{
+		{"committed", "", nil, "COMMIT"},
+		{"rejected before commit", "", errors.New("too many errors"), "ROLLBACK"},
+		{"flush failed", "INSERT", nil, "ROLLBACK"},
+	}
+	for _, test := range tests {
+		db, d := openFakeDB(t)
+		batch, err := NewBatch(db, 0)
+		if err != nil {
+			t.Fatal(test.name, err)
+		}
+		if test.before != nil {
+			batch.BeforeCommit = func() error { return test.before }
+		}
+		committed := false
+		batch.OnCommit = func() { committed = true }
+		if err := batch.Write(&bulkKeyed{ID: "a"}); err != nil {
+			t.Fatal(test.name, err)
+		}
+
+		d.failing = test.failing
+		err = batch.Commit()
+		if (err != nil) != (test.last == "ROLLBACK") {
+			t.Errorf("%s: error %v", test.name, err)
+		}
+		if committed != (err == nil) {
+			t.Errorf("%s: OnCommit called %v", test.name, committed)
+		}
+		statements := d.matching("")
+		if last := statements[len(statements) - 1].query; last != test.last {
+			t.Errorf("%s: ended with %s, want %s", test.name, last, test.last)
+		}
+		if len(batch.writer.tables) > 0 && len(batch.writer.tables[0].rows) > 0 {
+			t.Errorf("%s: rows still buffered", test.name)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package dataloaders
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Most rows of a source, as a percentage, that may have errors before its
+// load fails
+var MaxErrorRate = 100.0
+
+// Where the validation summary is written at the end of a run, as JSON or as
+// CSV if the path ends in .csv. Blank for no report.
+var ReportPath = ""
+
+// A problem with a column of a source row
+type LoadError struct {
+	RunID string `gorm:"primary_key"`
+	Source string `gorm:"primary_key"`
+	Line int `gorm:"primary_key"`
+	Column string `gorm:"primary_key"`
+	Value string
+	Reason string
+	CreatedAt time.Time
+}
+
+// Stringer for LoadError
+func (e LoadError) String() string {
+	return e.Source + " line " + strconv.Itoa(e.Line) + " " + e.Column + " " + strconv.Quote(e.Value) + ": " + e.Reason
+}
+
+// Counts the rows of a source and the errors found in them
+type Validation struct {
+	Source string `json:"source"`
+	Rows int `json:"rows"`
+	Rejected int `json:"rejected"`
+	RowsWithErrors int `json:"rows_with_errors"`
+	ErrorRate float64 `json:"error_rate"`
+	Errors map[string]int `json:"errors_by_column"`
+}
+
+var (
+	validationsMu sync.Mutex
+	validations []*Validation
+)
+
+// Starts counting a source's rows, adding it to the run's summary
+func NewValidation(source string) *Validation {
+	v := &Validation{Source: source, Errors: make(map[string]int)}
+	validationsMu.Lock()
+	defer validationsMu.Unlock()
+	validations = append(validations, v)
+	return v
+}
+
+// Counts a row and its errors. A rejected row was not loaded.
+func (v *Validation) Row(errs []LoadError, rejected bool) {
+	validationsMu.Lock()
+	defer validationsMu.Unlock()
+	v.Rows += 1
+	if rejected {
+		v.Rejected += 1
+	}
+	if len(errs) > 0 {
+		v.RowsWithErrors += 1
+	}
+	for _, e := range errs {
+		v.Errors[e.Column] += 1
+	}
+	if v.Rows > 0 {
+		v.ErrorRate = float64(v.RowsWithErrors) * 100 / float64(v.Rows)
+	}
+}
+
+// Rows of a source counted before its error rate is checked part way through
+const errorRateMinRows = 100
+
+// Returns an error if more of the source's rows have errors than MaxErrorRate
+// allows
+func (v *Validation) Check() error {
+	validationsMu.Lock()
+	defer validationsMu.Unlock()
+	log.Printf("Validated %s: %d rows, %d rejected, %d with errors (%.2f%%)", v.Source, v.Rows, v.Rejected, v.RowsWithErrors, v.ErrorRate)
+	return v.exceeded()
+}
+
+// Returns an error if more of the rows counted so far have errors than
+// MaxErrorRate allows, once there are enough rows to judge, so a load can fail
+// before committing a batch
+func (v *Validation) CheckSoFar() error {
+	validationsMu.Lock()
+	defer validationsMu.Unlock()
+	if v.Rows < errorRateMinRows {
+		return nil
+	}
+	return v.exceeded()
+}
+
+func (v *Validation) exceeded() error {
+	if v.ErrorRate > MaxErrorRate {
+		return fmt.Errorf("%s: %.2f%% of rows have errors, more than the %.2f%% allowed", v.Source, v.ErrorRate, MaxErrorRate)
+	}
+	return nil
+}
+
+// Writes the summary of every source validated in this run to ReportPath
+func WriteValidationReport() error {
+	if ReportPath == "" {
+		return nil
+	}
+	validationsMu.Lock()
+	defer validationsMu.Unlock()
+
+	file, err := os.Create(ReportPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if strings.ToLower(filepath.Ext(ReportPath)) != ".csv" {
+		enc := json.NewEncoder(file)
+		enc.SetIndent("", "  ")
+		summary := struct {
+			RunID string `json:"run_id"`
+			Sources []*Validation `json:"sources"`
+		}{RunID, validations}
+		if summary.Sources == nil {
+			summary.Sources = []*Validation{}
+		}
+		return enc.Encode(summary)
+	}
+
+	w := csv.NewWriter(file)
+	w.Write([]string{"run_id", "source", "rows", "rejected", "rows_with_errors", "error_rate", "errors_by_column"})
+	for _, v := range validations {
+		columns := make([]string, 0, len(v.Errors))
+		for column := range v.Errors {
+			columns = append(columns, column)
+		}
+		sort.Strings(columns)
+		for i, column := range columns {
+			columns[i] = column + "=" + strconv.Itoa(v.Errors[column])
+		}
+		w.Write([]string{RunID, v.Source, strconv.Itoa(v.Rows), strconv.Itoa(v.Rejected),
+			strconv.Itoa(v.RowsWithErrors), strconv.FormatFloat(v.ErrorRate, 'f', 2, 64), strings.Join(columns, ";")})
+	}
+	w.Flush()
+	return w.Error()
+}
+
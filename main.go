@@ -1,20 +1,24 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"flag"
+	"fmt"
 	"os"
+	"os/signal"
 	"os/user"
 	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
  	"github.com/jinzhu/gorm"
     _ "github.com/jinzhu/gorm/dialects/postgres"
     "github.com/monkeyx/datagovuk-loader/dataloaders"
 )
 
-// Interface for Data.gov.uk data loaders
-type DataLoader interface {
-	Load(db *gorm.DB) (error)
-}
-
 func sqlConnectionString() (string, error) {
 	db_host := os.Getenv("DB_HOST")
 	if db_host == "" {
@@ -44,24 +48,260 @@ func sqlConnectionString() (string, error) {
 	return dbString + " password=" + db_password, nil
 }
 
-func dataLoader() (DataLoader, error) {
-	argsWithoutProg := os.Args[1:]
+// Prints the registered data loaders
+func listDataLoaders() {
+	for _, r := range dataloaders.Registered() {
+		fmt.Printf("%s\t%s\n", r.Name, r.Description)
+		for _, src := range r.Sources {
+			fmt.Println("\tsource:", src)
+		}
+		fmt.Println("\ttables:", strings.Join(r.Tables, ", "))
+	}
+}
+
+// Number of load runs listed by the history command
+const historyRuns = 20
+
+// Prints the most recent load runs, optionally only those of one loader
+func listHistory(db *gorm.DB, loader string) error {
+	runs, err := dataloaders.History(db, loader, historyRuns)
+	if err != nil {
+		return err
+	}
+	for _, run := range runs {
+		duration := "-"
+		if run.FinishedAt != nil {
+			duration = run.FinishedAt.Sub(run.StartedAt).String()
+		}
+		fmt.Printf("%d\t%s\t%s\t%s\t%s\t%s\n", run.ID, run.StartedAt.Format("2006-01-02 15:04:05"),
+			duration, run.Loader, run.Status, run.RunID)
+		counts := run.Counts()
+		tables := make([]string, 0, len(counts))
+		for table := range counts {
+			tables = append(tables, table)
+		}
+		sort.Strings(tables)
+		for _, table := range tables {
+			c := counts[table]
+			fmt.Printf("\t%s: %d inserted, %d updated, %d skipped\n", table, c.Inserted, c.Updated, c.Skipped)
+		}
+		orphans := run.OrphanCounts()
+		keys := make([]string, 0, len(orphans))
+		for key := range orphans {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			o := orphans[key]
+			fmt.Printf("\t%s: %d missing references dropped, %d rows orphaned\n", key, o.Dropped, o.Remaining)
+		}
+		for _, src := range run.FetchedSources() {
+			switch {
+			case src.Unchanged:
+				fmt.Println("\tsource:", src.Url, "(unchanged)")
+			case src.Checksum != "":
+				fmt.Println("\tsource:", src.Url, src.Checksum)
+			default:
+				fmt.Println("\tsource:", src.Url)
+			}
+		}
+		if run.Error != "" {
+			fmt.Println("\terror:", run.Error)
+		}
+	}
+	return nil
+}
+
+func dataLoaders() ([]dataloaders.Registration, error) {
+	argsWithoutProg := flag.Args()
 	if len(argsWithoutProg) < 1 {
 		return nil, errors.New("No data loader specified")
 	}
-	switch argsWithoutProg[0] {
-		default: 
-			return nil, errors.New("No data loader specified")
-		case "postcode":
-			return &dataloaders.PostCodeLoader{}, nil
-		case "school":
-			return &dataloaders.SchoolLoader{}, nil 
+	loaders := make([]dataloaders.Registration, 0, len(argsWithoutProg))
+	for _, name := range argsWithoutProg {
+		r, err := dataloaders.Lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		loaders = append(loaders, r)
 	}
+	return loaders, nil
+}
+
+// Flag adding "Name: value" HTTP headers
+type headerFlag http.Header
+
+func (h headerFlag) String() string {
+	return ""
+}
+
+func (h headerFlag) Set(value string) error {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 {
+		return errors.New("header must be \"Name: value\"")
+	}
+	http.Header(h).Add(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+	return nil
+}
+
+// Flag setting a source's encoding as "name=encoding"
+type encodingFlag map[string]string
+
+func (e encodingFlag) String() string {
+	return ""
+}
+
+func (e encodingFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 {
+		return errors.New("encoding must be \"name=encoding\"")
+	}
+	encoding, err := dataloaders.NormaliseEncoding(parts[1])
+	if err != nil {
+		return err
+	}
+	e[strings.TrimSpace(parts[0])] = encoding
+	return nil
+}
+
+// Writes the validation summary so far, if one was asked for
+func writeReport() {
+	if err := dataloaders.WriteValidationReport(); err != nil {
+		log.Println("Error writing validation report:", err)
+	}
+}
+
+// Flag setting where a source is loaded from, or its URL template, as
+// "name=location"
+type sourceFlag map[string]string
+
+func (s sourceFlag) String() string {
+	return ""
+}
+
+func (s sourceFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+		return errors.New("must be \"name=location\"")
+	}
+	s[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	return nil
+}
+
+// Exit status when a load is stopped by SIGINT or SIGTERM
+const exitInterrupted = 130
+
+// Returns a context that is cancelled on SIGINT or SIGTERM. A second signal
+// kills the process, e.g. if it is stuck in a database statement.
+func interruptContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Println("Received", sig, "- stopping after the current batch, signal again to stop now")
+		cancel()
+		signal.Stop(signals)
+	}()
+	return ctx
 }
 
 func main() {
 	// log.Println("args: ", os.Args)
 
+	flag.BoolVar(&dataloaders.Restart, "restart", false, "ignore checkpoints and fetch from the first page")
+	flag.IntVar(&dataloaders.Workers, "workers", 1, "pages fetched concurrently by each fetcher")
+	flag.Float64Var(&dataloaders.RequestsPerSecond, "rate", 0, "most requests per second to any one host, 0 for no limit")
+	flag.BoolVar(&dataloaders.Force, "force", false, "reload sources even if unchanged since the last load")
+	flag.DurationVar(&dataloaders.HttpTimeout, "timeout", dataloaders.HttpTimeout, "time allowed to wait for HTTP response headers")
+	flag.DurationVar(&dataloaders.HttpPageTimeout, "page-timeout", dataloaders.HttpPageTimeout, "time allowed to download a page of the post code API before it is retried, 0 for no limit")
+	flag.DurationVar(&dataloaders.HttpConnectTimeout, "connect-timeout", dataloaders.HttpConnectTimeout, "time allowed to connect to a host")
+	flag.StringVar(&dataloaders.UserAgent, "user-agent", dataloaders.UserAgent, "User-Agent sent with HTTP requests")
+	flag.StringVar(&dataloaders.HttpProxy, "proxy", "", "proxy URL for HTTP requests, default: from HTTP_PROXY/HTTPS_PROXY")
+	flag.Var(headerFlag(dataloaders.HttpHeaders), "header", "extra HTTP header as \"Name: value\", may be repeated")
+	flag.Var(encodingFlag(dataloaders.SourceEncodings), "encoding", "source encoding as name=encoding, e.g. edubase=utf-8, may be repeated")
+	flag.Float64Var(&dataloaders.MaxErrorRate, "max-error-rate", dataloaders.MaxErrorRate, "most rows of a CSV source, as a percentage, that may have errors before its load fails")
+	flag.Var(sourceFlag(dataloaders.SourceLocations), "source", "load a source from a URL, file or archive as name=location, e.g. edubase=/data/edubase.csv.gz, may be repeated")
+	flag.Var(sourceFlag(dataloaders.SourceTemplates), "source-template", "URL template used with --year as name=template, e.g. ks4=https://example.org/{year}/england_ks4.csv, may be repeated")
+	flag.StringVar(&dataloaders.Year, "year", "", "academic year to load, e.g. 2015-16, default: from DATASET_YEAR or the config file")
+	configFile := flag.String("config", "", "JSON config file of year, sources and templates, default: from CONFIG_FILE")
+	flag.BoolVar(&dataloaders.AllowSchemaDrift, "allow-schema-drift", false, "load CSV sources even if expected columns are missing from their header")
+	flag.StringVar(&dataloaders.ReportPath, "report", "", "write a validation summary to this file, as CSV if it ends in .csv, otherwise JSON")
+	flag.IntVar(&dataloaders.BatchSize, "batch-size", 0, "rows committed per transaction by the CSV loaders and post code files, 0 for whole files, default: from BATCH_SIZE")
+	flag.Parse()
+
+	batchSizeSet := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "batch-size" {
+			batchSizeSet = true
+		}
+	})
+
+	if batchSize := os.Getenv("BATCH_SIZE"); !batchSizeSet && batchSize != "" {
+		size, err := strconv.Atoi(batchSize)
+
+		if err != nil {
+			log.Fatal("Invalid BATCH_SIZE:", err)
+			return
+		}
+
+		dataloaders.BatchSize = size
+	}
+
+	if dataloaders.BatchSize < 0 {
+		log.Fatal("Invalid --batch-size or BATCH_SIZE: must be 0 or more")
+		return
+	}
+
+	if dataloaders.Year == "" {
+		dataloaders.Year = os.Getenv("DATASET_YEAR")
+	}
+
+	if *configFile == "" {
+		*configFile = os.Getenv("CONFIG_FILE")
+	}
+
+	if *configFile != "" {
+		if err := dataloaders.LoadConfig(*configFile); err != nil {
+			log.Fatal("Error reading config:", err)
+			return
+		}
+	}
+
+	if dataloaders.Year != "" {
+		start, err := dataloaders.ParseAcademicYear(dataloaders.Year)
+
+		if err != nil {
+			log.Fatal(err)
+			return
+		}
+
+		dataloaders.Year = dataloaders.AcademicYear(start)
+	}
+
+	if dataloaders.MaxErrorRate < 0 || dataloaders.MaxErrorRate > 100 {
+		log.Fatal("Invalid --max-error-rate: must be between 0 and 100")
+		return
+	}
+
+	if flag.Arg(0) == "list" {
+		listDataLoaders()
+		return
+	}
+
+	history := flag.Arg(0) == "history"
+	var loaders []dataloaders.Registration
+	var err error
+
+	if !history {
+		loaders, err = dataLoaders()
+
+		if err != nil {
+			log.Fatal("Error getting data loader:", err)
+			return
+		}
+	}
+
 	dbString, err := sqlConnectionString()
 
 	if err != nil {
@@ -78,17 +318,31 @@ func main() {
 		return
 	}
 
-	loader, err := dataLoader()
+	if history {
+		err = listHistory(db, flag.Arg(1))
 
-	if err != nil {
-		log.Fatal("Error getting data loader:", err)
+		if err != nil {
+			log.Fatal("Error listing load runs:", err)
+		}
 		return
 	}
 
-	err = loader.Load(db)
+	ctx := interruptContext()
 
-	if err != nil {
-		log.Fatal("Error getting data loader:", err)
-		return
+	for _, r := range loaders {
+		log.Println("Loading:", r.Name)
+		err = dataloaders.Run(ctx, db, r)
+		writeReport()
+
+		if ctx.Err() != nil {
+			log.Println("Interrupted loading " + r.Name + ":", err)
+			db.Close()
+			os.Exit(exitInterrupted)
+		}
+
+		if err != nil {
+			log.Fatal("Error loading " + r.Name + ":", err)
+			return
+		}
 	}
 }
\ No newline at end of file